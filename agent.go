@@ -1,8 +1,10 @@
 package agogo
 
 import (
+	"context"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/notnil/chess"
@@ -24,30 +26,97 @@ type Agent struct {
 	inferer  chan Inferer
 	err      error
 	inferers []Inferer
+
+	// BatchSize, when larger than 1, makes the agent evaluate leaves through a Batcher which flushes
+	// after BatchTimeout instead of running one position at a time. BatchTimeout must then be positive.
+	BatchSize    int
+	BatchTimeout time.Duration
+	batcher      *Batcher
+
+	// network and version of its weights the inferers were built from
+	inferNN      *dual.Dual
+	inferVersion uint64
+
+	// Cache, if set, holds the evaluations of positions already seen. It is emptied whenever the weights of NN
+	// change, agents sharing NN may share a cache.
+	Cache *EvalCache
 }
 
 // SwitchToInference uses the inference mode neural network.
+// The inferers are created once and share the inference weights of NN, they are only rebuilt when NN or its
+// weights have changed since the last call.
 func (a *Agent) SwitchToInference() (err error) {
 	a.Lock()
-	a.inferer = make(chan Inferer, a.MCTS.NumSimulation)
+	defer a.Unlock()
+	if a.inferNN == a.NN && a.inferVersion == a.NN.Version() && (a.inferer != nil || a.batcher != nil) {
+		return nil
+	}
+	if err = a.close(); err != nil {
+		return err
+	}
+	version := a.NN.Version()
+	if a.Cache != nil {
+		a.Cache.setWeights(a.NN, version)
+	}
 
-	for i := 0; i < a.MCTS.NumSimulation; i++ {
-		var inf Inferer
-		if inf, err = dual.Infer(a.NN, false); err != nil {
+	if a.BatchSize > 1 {
+		if err = a.switchToBatchInference(); err != nil {
+			return err
+		}
+	} else {
+		// every simulation evaluates one position at a time
+		var w *dual.Weights
+		if w, err = a.NN.InferenceWeights(1); err != nil {
 			return err
 		}
-		a.inferers = append(a.inferers, inf)
-		a.inferer <- inf
+		a.inferer = make(chan Inferer, a.MCTS.NumSimulation)
+		for i := 0; i < a.MCTS.NumSimulation; i++ {
+			var inf Inferer
+			if inf, err = w.Inferencer(false); err != nil {
+				return err
+			}
+			a.inferers = append(a.inferers, inf)
+			a.inferer <- inf
+		}
+	}
+	a.inferNN, a.inferVersion = a.NN, version
+	return nil
+}
+
+// switchToBatchInference uses a single inference mode neural network shared by all simulations through a Batcher.
+func (a *Agent) switchToBatchInference() error {
+	w, err := a.NN.InferenceWeights(a.BatchSize)
+	if err != nil {
+		return err
+	}
+	inf, err := w.Inferencer(false)
+	if err != nil {
+		return err
+	}
+	if a.batcher, err = NewBatcher(inf, a.Enc, a.BatchSize, a.BatchTimeout); err != nil {
+		inf.Close()
+		return err
 	}
-	// a.NN = nil // remove old NN
-	a.Unlock()
 	return nil
 }
 
 // Infer infers a bunch of moves based on the game state.
 // This is mainly used to implement a Inferer such that the MCTS search can use it.
+// Positions found in Cache are not evaluated again.
 func (a *Agent) Infer(g game.State) (policy []float32, value float32) {
 	input := a.Enc(g)
+	if a.Cache != nil {
+		if policy, value, ok := a.Cache.Get(input); ok {
+			return policy, value
+		}
+	}
+	if a.batcher != nil {
+		policy, value = a.batcher.inferBoard(input)
+		if a.Cache != nil {
+			a.Cache.Put(input, policy, value)
+		}
+		return policy, value
+	}
 	inf := <-a.inferer
 
 	var err error
@@ -58,7 +127,12 @@ func (a *Agent) Infer(g game.State) (policy []float32, value float32) {
 		}
 		panic(err)
 	}
+	// the policy is copied before the inferer, which reuses its output buffer, is handed back
+	policy = append([]float32(nil), policy...)
 	a.inferer <- inf
+	if a.Cache != nil {
+		a.Cache.Put(input, policy, value)
+	}
 	return
 }
 
@@ -68,15 +142,40 @@ func (a *Agent) Search(g game.State) (game.Move, error) {
 	return a.MCTS.Search()
 }
 
+// SearchWithBudget searches the game state until the budget is used up or ctx is done and returns
+// the best move found so far.
+func (a *Agent) SearchWithBudget(ctx context.Context, g game.State, budget mcts.Budget) (game.Move, error) {
+	a.MCTS.SetGame(g)
+	return a.MCTS.SearchWithBudget(ctx, budget)
+}
+
 // Close closes channel to free up memory.
 func (a *Agent) Close() error {
-	close(a.inferer)
+	a.Lock()
+	defer a.Unlock()
+	return a.close()
+}
+
+// close releases the inferers, the caller must hold the lock.
+func (a *Agent) close() error {
 	var errs error
+	if a.batcher != nil {
+		if err := a.batcher.Close(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		a.batcher = nil
+	}
+	if a.inferer != nil {
+		close(a.inferer)
+		a.inferer = nil
+	}
 	for _, inferer := range a.inferers {
 		if err := inferer.Close(); err != nil {
 			errs = multierror.Append(errs, err)
 		}
 	}
+	a.inferers = nil
+	a.inferNN = nil
 	if errs != nil {
 		return errs
 	}
@@ -4,6 +4,7 @@ import (
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"math/rand"
@@ -13,7 +14,9 @@ import (
 
 	dual "github.com/alphabeth/dualnet"
 	"github.com/alphabeth/game"
+	"github.com/alphabeth/internal/atomicfile"
 	"github.com/alphabeth/mcts"
+	"github.com/hashicorp/go-multierror"
 	"github.com/pkg/errors"
 	"gorgonia.org/tensor"
 )
@@ -24,10 +27,21 @@ const (
 	modelFile = "checkpoint.model"
 )
 
+// action encodings of a checkpoint.
+const (
+	alphaZeroActions = "alphazero" // the AlphaZero 8x8x73 move encoding
+	movesActions     = "moves"     // the moves of a moves file, stored in the checkpoint
+)
+
 // MetaData consists of exported params for model.
+// Together with the model it describes everything needed to play with a checkpoint: the encoding of the input
+// planes and the ordered action space of the policy head.
 type MetaData struct {
-	NNConf   dual.Config `json:"nn_conf"`
-	MCTSConf mcts.Config `json:"mcts_conf"`
+	NNConf   dual.Config      `json:"nn_conf"`
+	MCTSConf mcts.Config      `json:"mcts_conf"`
+	Encoder  game.EncoderInfo `json:"encoder"`
+	Actions  string           `json:"actions"`         // action encoding, empty for checkpoints predating it
+	Moves    []game.Move      `json:"moves,omitempty"` // action space of the moves encoding, in index order
 }
 
 // AZ is the top level structure and the entry point of the API.
@@ -36,17 +50,29 @@ type MetaData struct {
 type AZ struct {
 	// state
 	Arena
+	// Replay holds the self-play examples the network is trained on.
+	Replay *ReplayBuffer
+	// Metrics, if set, receives the training metrics of every batch and epoch.
+	Metrics func(TrainMetrics)
 
 	// config
 	nnConf          dual.Config
 	mctsConf        mcts.Config
 	enc             GameEncoder
+	encInfo         game.EncoderInfo
 	updateThreshold float32
 	maxExamples     int
+	selfPlayWorkers int
+
+	// training progress
+	iteration       int    // number of finished training iterations
+	checkpointDir   string // directory receiving a checkpoint after every iteration, none if empty
+	keepCheckpoints int    // number of checkpoints kept in checkpointDir, all if 0
 }
 
 // New AlphaZero structure. It takes a game state (implementing the board, rules, etc.)
-// and a configuration to apply to the MCTS and the neural network
+// and a configuration to apply to the MCTS and the neural network.
+// A replay config without any limit keeps the games of the current iteration only, see ReplayConfig.
 func New(g game.State, conf Config) *AZ {
 	if !conf.NNConf.IsValid() {
 		panic("NNConf is not valid. Unable to proceed")
@@ -54,6 +80,16 @@ func New(g game.State, conf Config) *AZ {
 	if !conf.MCTSConf.IsValid() {
 		panic("MCTSConf is not valid. Unable to proceed")
 	}
+	if !conf.Replay.IsValid() {
+		panic("Replay config is not valid. Unable to proceed")
+	}
+	if conf.InferBatch > 1 && conf.InferBatchTimeout <= 0 {
+		panic("InferBatchTimeout must be positive for batched inference. Unable to proceed")
+	}
+	if conf.Replay.MaxGames == 0 && conf.Replay.MaxGenerations == 0 {
+		// without a window only the games of the current iteration are used, see ReplayConfig
+		conf.Replay.MaxGenerations = 1
+	}
 
 	a := dual.New(conf.NNConf)
 
@@ -63,11 +99,21 @@ func New(g game.State, conf Config) *AZ {
 
 	retVal := &AZ{
 		Arena:           MakeArena(g, a, conf.MCTSConf, conf.Encoder, conf.Name),
+		Replay:          NewReplayBuffer(conf.Replay),
 		nnConf:          conf.NNConf,
 		mctsConf:        conf.MCTSConf,
 		enc:             conf.Encoder,
+		encInfo:         conf.EncoderInfo,
 		updateThreshold: float32(conf.UpdateThreshold),
 		maxExamples:     conf.MaxExamples,
+		selfPlayWorkers: conf.SelfPlayWorkers,
+		checkpointDir:   conf.CheckpointDir,
+		keepCheckpoints: conf.KeepCheckpoints,
+	}
+	retVal.CurrentAgent.BatchSize = conf.InferBatch
+	retVal.CurrentAgent.BatchTimeout = conf.InferBatchTimeout
+	if conf.EvalCacheSize > 0 {
+		retVal.CurrentAgent.Cache = NewEvalCache(conf.EvalCacheSize)
 	}
 	return retVal
 }
@@ -76,43 +122,182 @@ func New(g game.State, conf Config) *AZ {
 // The difference between this and `Learn` function is that in Alpha Zero we just simply store the latest model
 // no need compete with the current best agent.
 func (a *AZ) LearnAZ(iters, episodes, nniters int) error {
-	var err error
-	var exs []Example
 	for epoch := 0; epoch < iters; epoch++ {
-		var examples []Example
-		for e := 0; e < episodes; e++ {
-			log.Printf("Episode %v\n", e)
+		if err := a.selfPlay(episodes); err != nil {
+			return err
+		}
+		if err := a.train(a.CurrentAgent.NN, a.sample(), nniters); err != nil {
+			return err
+		}
+		if err := a.endIteration(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			// generates training examples
-			if exs, err = a.SelfPlay(); err != nil {
-				return err
-			}
-			examples = append(examples, exs...)
+// Learn learns for iterations the AlphaGo Zero way. The current best agent self-plays for episodes, a candidate
+// is trained on the self play examples starting from a copy of the best network, and then the candidate plays
+// arenaGames evaluation games against the best agent. The candidate only replaces the best network when its score,
+// counting draws as half a win, is higher than UpdateThreshold.
+func (a *AZ) Learn(iters, episodes, nniters, arenaGames int) error {
+	if arenaGames <= 0 {
+		return errors.Errorf("invalid number of evaluation games %d", arenaGames)
+	}
+	for epoch := 0; epoch < iters; epoch++ {
+		if err := a.selfPlay(episodes); err != nil {
+			return err
+		}
+
+		candidate, err := a.CurrentAgent.NN.Clone()
+		if err != nil {
+			return errors.WithMessage(err, "Clone fail")
+		}
+		if err = a.train(candidate, a.sample(), nniters); err != nil {
+			return err
+		}
+
+		a.CandidateAgent = &Agent{
+			NN:           candidate,
+			Enc:          a.enc,
+			name:         "candidate agent",
+			BatchSize:    a.CurrentAgent.BatchSize,
+			BatchTimeout: a.CurrentAgent.BatchTimeout,
+		}
+		log.Printf("Iteration %d: evaluating candidate in %d games", a.iteration, arenaGames)
+		wins, draws, losses, err := a.Play(arenaGames)
+		if err != nil {
+			return err
 		}
 
-		if a.maxExamples > 0 && len(examples) > a.maxExamples {
-			shuffleExamples(examples)
-			examples = examples[:a.maxExamples]
+		score := (float32(wins) + 0.5*float32(draws)) / float32(arenaGames)
+		if score > a.updateThreshold {
+			log.Printf("Iteration %d: candidate promoted, score %.3f > %.3f (+%d =%d -%d)",
+				a.iteration, score, a.updateThreshold, wins, draws, losses)
+			a.CurrentAgent.NN = candidate
+		} else {
+			log.Printf("Iteration %d: candidate rejected, score %.3f <= %.3f (+%d =%d -%d)",
+				a.iteration, score, a.updateThreshold, wins, draws, losses)
 		}
-		Xs, Policies, Values, batches := a.prepareExamples(examples)
+		a.CandidateAgent.MCTS.Reset()
+		a.CandidateAgent = nil
+		if err := a.endIteration(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		if batches == 0 {
-			return errors.New("batches is nil, probably too few examples regarding the batchsize")
+// endIteration moves the replay buffer to the next generation and writes a checkpoint if a checkpoint
+// directory is set.
+func (a *AZ) endIteration() error {
+	a.Replay.NextGeneration()
+	a.iteration++
+	if a.checkpointDir == "" {
+		return nil
+	}
+	log.Printf("Iteration %d: writing checkpoint", a.iteration)
+	if err := a.Checkpoint(a.checkpointDir); err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("checkpoint of iteration %d", a.iteration))
+	}
+	if a.keepCheckpoints > 0 {
+		if err := pruneCheckpoints(a.checkpointDir, a.keepCheckpoints); err != nil {
+			return errors.WithMessage(err, "deleting old checkpoints")
 		}
+	}
+	return nil
+}
+
+// Iteration returns the number of finished training iterations, including the ones of a resumed checkpoint.
+func (a *AZ) Iteration() int { return a.iteration }
+
+// selfPlay lets the current agent play episodes games against itself and adds them to the replay buffer.
+func (a *AZ) selfPlay(episodes int) error {
+	if a.selfPlayWorkers > 1 {
+		return a.parallelSelfPlay(episodes)
+	}
+	for e := 0; e < episodes; e++ {
+		log.Printf("Episode %v\n", e)
 
-		log.Print("begin training")
-		if err = dual.Train(a.CurrentAgent.NN, Xs, Policies, Values, batches, nniters); err != nil {
-			return errors.WithMessage(err, fmt.Sprintf("Train fail"))
+		// generates training examples
+		exs, err := a.SelfPlay()
+		if err != nil {
+			return err
 		}
+		a.Replay.Add(exs)
 	}
+	a.logCacheStats()
 	return nil
 }
 
-// SaveAZ saves AlphaZero into filename.
+// parallelSelfPlay plays the self-play games of selfPlay on a SelfPlayPool.
+func (a *AZ) parallelSelfPlay(episodes int) error {
+	log.Printf("Playing %d episodes on %d workers", episodes, a.selfPlayWorkers)
+	var errs error
+	var e int
+	for res := range NewSelfPlayPool(&a.Arena, a.selfPlayWorkers).Play(episodes) {
+		if res.Err != nil {
+			errs = multierror.Append(errs, res.Err)
+			continue
+		}
+		log.Printf("Episode %v done\n", e)
+		e++
+		a.Replay.Add(res.Examples)
+	}
+	a.logCacheStats()
+	return errs
+}
+
+// logCacheStats logs the hit rate of the evaluation cache of the current agent, if it has one.
+func (a *AZ) logCacheStats() {
+	if a.CurrentAgent.Cache == nil {
+		return
+	}
+	stats := a.CurrentAgent.Cache.Stats()
+	log.Printf("evaluation cache: %.1f%% hits (%d hits, %d misses), %d of %d entries",
+		100*stats.HitRate(), stats.Hits, stats.Misses, stats.Entries, stats.Size)
+}
+
+// sample draws the training examples of an iteration from the replay buffer, at most maxExamples of them.
+func (a *AZ) sample() []Example {
+	n := a.Replay.Len()
+	if a.maxExamples > 0 && n > a.maxExamples {
+		n = a.maxExamples
+	}
+	log.Printf("sampling %d examples from %d games", n, a.Replay.Games())
+	return a.Replay.Sample(n)
+}
+
+// train trains nn on examples for nniters epochs.
+func (a *AZ) train(nn *dual.Dual, examples []Example, nniters int) error {
+	Xs, Policies, Values, batches := a.prepareExamples(examples)
+
+	if batches == 0 {
+		return errors.New("batches is nil, probably too few examples regarding the batchsize")
+	}
+
+	log.Print("begin training")
+	if err := dual.TrainWithMetrics(nn, Xs, Policies, Values, batches, nniters, a.reportMetrics()); err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("Train fail"))
+	}
+	return nil
+}
+
+// reportMetrics returns the function forwarding the training metrics of the current iteration to Metrics.
+func (a *AZ) reportMetrics() dual.MetricsFunc {
+	if a.Metrics == nil {
+		return nil
+	}
+	iteration := a.iteration
+	return func(m dual.Metrics) {
+		a.Metrics(TrainMetrics{Iteration: iteration, Metrics: m})
+	}
+}
+
+// SaveAZ saves AlphaZero into dirName, creating the directory if needed. Every file is written atomically.
 func (a *AZ) SaveAZ(dirName string) error {
-	err := os.Mkdir(dirName, 0755)
-	if err != nil {
-		return err
+	if err := os.MkdirAll(dirName, 0755); err != nil {
+		return errors.WithStack(err)
 	}
 
 	// Save config.
@@ -120,25 +305,31 @@ func (a *AZ) SaveAZ(dirName string) error {
 	metaConf := &MetaData{
 		NNConf:   a.nnConf,
 		MCTSConf: a.mctsConf,
+		Encoder:  a.encInfo,
+	}
+	if g, ok := a.game.(*game.Chess); ok {
+		metaConf.Actions = alphaZeroActions
+		if !g.FullEncoding() {
+			metaConf.Actions = movesActions
+			metaConf.Moves = g.Moves()
+		}
 	}
 	jsonStr, err := json.MarshalIndent(metaConf, "", "	")
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(metaPath, jsonStr, 0544)
-	if err != nil {
+	err = atomicfile.Write(metaPath, 0644, func(w io.Writer) error {
+		_, err := w.Write(jsonStr)
 		return err
-	}
-
-	modelPath := filepath.Join(dirName, modelFile)
-	f, err := os.OpenFile(modelPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0544)
+	})
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	enc := gob.NewEncoder(f)
-	return enc.Encode(a.CurrentAgent.NN)
+	modelPath := filepath.Join(dirName, modelFile)
+	return atomicfile.Write(modelPath, 0644, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(a.CurrentAgent.NN)
+	})
 }
 
 // Load loads the Alpha model structure from a filename.
@@ -159,27 +350,43 @@ func (a *AZ) Load(filename string) error {
 }
 
 // Load loads model based on checkpoint and meta data.
-func Load(dirName, fileMoves string, encoder func(g game.State) []float32) (*AZ, error) {
+// The action space and input encoder are rebuilt from the checkpoint. A non empty fileMoves or a non nil encoder
+// are checked against the checkpoint instead, and a mismatch is an error. Checkpoints that do not store their
+// action space use the moves of fileMoves, or the AlphaZero 8x8x73 move encoding if it is empty, and need an encoder.
+func Load(dirName, fileMoves string, encoder game.Encoder) (*AZ, error) {
 	metaPath := filepath.Join(dirName, metaFile)
 	metaStr, err := ioutil.ReadFile(metaPath)
 	if err != nil {
 		return nil, err
 	}
-	metaConf := &MetaData{}
+	// checkpoints predating the root noise settings get the AlphaZero defaults for them
+	metaConf := &MetaData{MCTSConf: mcts.DefaultConfig()}
 	err = json.Unmarshal(metaStr, metaConf)
 	if err != nil {
 		return nil, err
 	}
 
+	g, err := metaConf.game(fileMoves)
+	if err != nil {
+		return nil, errors.WithMessage(err, dirName)
+	}
+	if encoder, err = metaConf.encoder(encoder); err != nil {
+		return nil, errors.WithMessage(err, dirName)
+	}
+	if g.ActionSpace() != metaConf.NNConf.ActionSpace {
+		return nil, errors.Errorf("%s: action space has %d moves, the network has %d outputs",
+			dirName, g.ActionSpace(), metaConf.NNConf.ActionSpace)
+	}
+
 	conf := Config{
-		Name:     "Alphabeth",
-		NNConf:   metaConf.NNConf,
-		MCTSConf: metaConf.MCTSConf,
+		Name:        "Alphabeth",
+		NNConf:      metaConf.NNConf,
+		MCTSConf:    metaConf.MCTSConf,
+		Encoder:     encoder.Encode,
+		EncoderInfo: encoder.Info(),
 	}
-	conf.Encoder = encoder
 
 	modelPath := filepath.Join(dirName, modelFile)
-	g := game.ChessGame(fileMoves)
 	a := New(g, conf)
 	err = a.Load(modelPath)
 	if err != nil {
@@ -189,6 +396,68 @@ func Load(dirName, fileMoves string, encoder func(g game.State) []float32) (*AZ,
 	return a, nil
 }
 
+// game rebuilds the game of the checkpoint, checking the moves of fileMoves against it if it is not empty.
+func (m *MetaData) game(fileMoves string) (*game.Chess, error) {
+	var moves []game.Move
+	if fileMoves != "" {
+		var err error
+		if moves, err = game.LoadMoves(fileMoves); err != nil {
+			return nil, err
+		}
+	}
+
+	switch m.Actions {
+	case "":
+		// the checkpoint predates storing the action space, the caller has to know it
+		if fileMoves == "" {
+			return game.ChessGameAZ(), nil
+		}
+		return game.ChessGameFromMoves(moves), nil
+	case alphaZeroActions:
+		if fileMoves != "" {
+			return nil, errors.Errorf("checkpoint uses the AlphaZero move encoding, not the moves of %s", fileMoves)
+		}
+		return game.ChessGameAZ(), nil
+	case movesActions:
+		if fileMoves != "" {
+			if len(moves) != len(m.Moves) {
+				return nil, errors.Errorf("%s has %d moves, the checkpoint has %d", fileMoves, len(moves), len(m.Moves))
+			}
+			for i := range moves {
+				if moves[i] != m.Moves[i] {
+					return nil, errors.Errorf("move %d of %s is %s, the checkpoint has %s", i, fileMoves, moves[i], m.Moves[i])
+				}
+			}
+		}
+		return game.ChessGameFromMoves(m.Moves), nil
+	}
+	return nil, errors.Errorf("unknown action encoding %q", m.Actions)
+}
+
+// encoder returns the input encoder of the checkpoint, checking encoder against it if it is not nil.
+func (m *MetaData) encoder(encoder game.Encoder) (game.Encoder, error) {
+	if m.Encoder == (game.EncoderInfo{}) {
+		// the checkpoint predates storing the encoder, the caller has to know it
+		if encoder == nil {
+			return nil, errors.New("checkpoint does not name its input encoder, an encoder is needed")
+		}
+		if planes := encoder.Info().Planes; planes != m.NNConf.Features {
+			return nil, errors.Errorf("encoder produces %d planes, the network expects %d", planes, m.NNConf.Features)
+		}
+		return encoder, nil
+	}
+	if m.Encoder.Planes != m.NNConf.Features {
+		return nil, errors.Errorf("encoder %+v does not match the %d planes of the network", m.Encoder, m.NNConf.Features)
+	}
+	if encoder == nil {
+		return game.NewEncoder(m.Encoder)
+	}
+	if info := encoder.Info(); info != m.Encoder {
+		return nil, errors.Errorf("encoder %+v does not match the encoder %+v of the checkpoint", info, m.Encoder)
+	}
+	return encoder, nil
+}
+
 func (a *AZ) prepareExamples(examples []Example) (Xs, Policies, Values *tensor.Dense, batches int) {
 	shuffleExamples(examples)
 	batches = len(examples) / a.nnConf.BatchSize
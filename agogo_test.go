@@ -0,0 +1,187 @@
+package agogo
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alphabeth/game"
+	"github.com/alphabeth/mcts"
+	"github.com/stretchr/testify/assert"
+)
+
+var testMoves = []game.Move{"e2e4", "d2d4", "g1f3", "b1c3"}
+
+// saveTestCheckpoint saves a small network playing with testMoves into a temporary directory.
+func saveTestCheckpoint(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := game.ChessGameFromMoves(testMoves)
+	if err := New(g, testConfig(g)).SaveAZ(dir); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("%+v", err)
+	}
+	return dir
+}
+
+// writeTestMoves writes a moves file holding moves.
+func writeTestMoves(t *testing.T, dir string, moves []game.Move) string {
+	lines := make([]string, len(moves))
+	for i, m := range moves {
+		lines[i] = string(m)
+	}
+	filename := filepath.Join(dir, "moves.txt")
+	if err := ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// editMeta rewrites the meta data of the checkpoint in dir.
+func editMeta(t *testing.T, dir string, edit func(*MetaData)) {
+	filename := filepath.Join(dir, metaFile)
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta MetaData
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	edit(&meta)
+	if data, err = json.Marshal(meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	assert := assert.New(t)
+	dir := saveTestCheckpoint(t)
+	defer os.RemoveAll(dir)
+
+	a, err := Load(dir, "", nil)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assert.Equal(len(testMoves), a.State().ActionSpace())
+	assert.Equal(game.SimpleEncoder{}.Info(), a.encInfo)
+
+	// the same moves and encoder are accepted
+	a, err = Load(dir, writeTestMoves(t, dir, testMoves), game.SimpleEncoder{})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assert.Equal(len(testMoves), a.State().ActionSpace())
+}
+
+func TestLoadWrongMoves(t *testing.T) {
+	assert := assert.New(t)
+	dir := saveTestCheckpoint(t)
+	defer os.RemoveAll(dir)
+
+	reordered := []game.Move{"d2d4", "e2e4", "g1f3", "b1c3"}
+	_, err := Load(dir, writeTestMoves(t, dir, reordered), nil)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "move 0 of")
+	}
+
+	_, err = Load(dir, writeTestMoves(t, dir, testMoves[:3]), nil)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "has 3 moves, the checkpoint has 4")
+	}
+}
+
+func TestLoadWrongEncoder(t *testing.T) {
+	assert := assert.New(t)
+	dir := saveTestCheckpoint(t)
+	defer os.RemoveAll(dir)
+
+	_, err := Load(dir, "", game.HistoryEncoder{T: game.HistoryLength})
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "does not match the encoder")
+	}
+
+	editMeta(t, dir, func(meta *MetaData) { meta.Encoder.Name = "unknown" })
+	_, err = Load(dir, "", nil)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "unknown input encoder")
+	}
+}
+
+func TestLoadWrongPlanes(t *testing.T) {
+	assert := assert.New(t)
+	dir := saveTestCheckpoint(t)
+	defer os.RemoveAll(dir)
+
+	editMeta(t, dir, func(meta *MetaData) { meta.Encoder.Planes++ })
+	_, err := Load(dir, "", nil)
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "planes of the network")
+	}
+
+	// checkpoints without encoder need an encoder producing the planes of the network
+	editMeta(t, dir, func(meta *MetaData) { meta.Encoder = game.EncoderInfo{} })
+	_, err = Load(dir, "", game.HistoryEncoder{T: game.HistoryLength})
+	if assert.Error(err) {
+		assert.Contains(err.Error(), "encoder produces 119 planes, the network expects 2")
+	}
+	_, err = Load(dir, "", nil)
+	assert.Error(err)
+	_, err = Load(dir, "", game.SimpleEncoder{})
+	assert.NoError(err)
+}
+
+func TestLoadWithoutNoiseConfig(t *testing.T) {
+	assert := assert.New(t)
+	dir := saveTestCheckpoint(t)
+	defer os.RemoveAll(dir)
+
+	// checkpoints saved before the root noise settings existed have none of their fields
+	filename := filepath.Join(dir, metaFile)
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta map[string]json.RawMessage
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	var mctsConf map[string]interface{}
+	if err := json.Unmarshal(meta["mcts_conf"], &mctsConf); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"Epsilon", "DirichletParam", "DisableNoise", "VirtualLoss"} {
+		if _, ok := mctsConf[field]; !ok {
+			t.Fatalf("Expected %s in the MCTS config of %s", field, data)
+		}
+		delete(mctsConf, field)
+	}
+	if meta["mcts_conf"], err = json.Marshal(mctsConf); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = json.Marshal(meta); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filename, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := Load(dir, "", nil)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	defaults := mcts.DefaultConfig()
+	assert.Equal(defaults.Epsilon, a.mctsConf.Epsilon)
+	assert.Equal(defaults.DirichletParam, a.mctsConf.DirichletParam)
+	assert.False(a.mctsConf.DisableNoise)
+	assert.Equal(float32(0), a.mctsConf.VirtualLoss)
+	assert.Equal(testConfig(game.ChessGameAZ()).MCTSConf.NumSimulation, a.mctsConf.NumSimulation)
+}
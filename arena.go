@@ -1,12 +1,16 @@
 package agogo
 
 import (
+	"fmt"
+	"io"
+	"log"
 	"runtime"
 
 	"github.com/alphabeth/game"
 	"github.com/alphabeth/mcts"
 	"github.com/chewxy/math32"
 	"github.com/notnil/chess"
+	"github.com/pkg/errors"
 )
 
 // Arena represents a game arena
@@ -15,11 +19,18 @@ type Arena struct {
 	game         game.State
 	CurrentAgent *Agent
 
+	// CandidateAgent challenges CurrentAgent in the evaluation matches of the gated training loop.
+	CandidateAgent *Agent
+
 	// state
 	conf mcts.Config
 
 	// only relevant to training
-	name string
+	name  string
+	games int // number of self-play games played so far
+
+	// PGN, if set, receives every self-play game in PGN format with per-move search annotations.
+	PGN io.Writer
 }
 
 // MakeArena makes an arena given a game.
@@ -45,21 +56,53 @@ func (a *Arena) SelfPlay() (examples []Example, err error) {
 		return nil, err
 	}
 
+	a.games++
+	var record *pgnRecord
+	if a.PGN != nil {
+		record = newPGNRecord(a.game)
+	}
+
+	var winner chess.Color
+	if a.game, examples, winner, err = selfPlayGame(a.CurrentAgent, a.game, record); err != nil {
+		return nil, err
+	}
+
+	if record != nil {
+		event := fmt.Sprintf("%s self-play", a.name)
+		if err := record.write(a.PGN, event, a.games, a.CurrentAgent.name, a.CurrentAgent.name, a.game); err != nil {
+			return nil, err
+		}
+	}
+	labelExamples(examples, winner)
+
+	a.CurrentAgent.MCTS.Reset()
+	a.game.Reset()
+	runtime.GC()
+
+	// the inferers are kept for the next game, they are only rebuilt once the weights change
+	a.CurrentAgent.MCTS = mcts.New(a.game, a.conf, a.CurrentAgent)
+	return examples, nil
+}
+
+// selfPlayGame lets agent play g against itself until the game ends, annotating every move in record if it is not
+// nil. It returns the final state, the examples with the colour to move as value, and the winner.
+func selfPlayGame(agent *Agent, g game.State, record *pgnRecord) (game.State, []Example, chess.Color, error) {
+	var examples []Example
 	var winner chess.Color
 	var ended bool
-	for ended, winner = a.game.Ended(); !ended; ended, winner = a.game.Ended() {
-		best, err := a.CurrentAgent.Search(a.game)
+	for ended, winner = g.Ended(); !ended; ended, winner = g.Ended() {
+		best, err := agent.Search(g)
 		if err != nil {
-			return nil, err
+			return g, nil, chess.NoColor, err
 		}
 		if best == game.ResignMove {
 			break
 		}
 
-		boards := a.CurrentAgent.Enc(a.game)
-		policies, err := a.CurrentAgent.MCTS.Policies()
+		boards := agent.Enc(g)
+		policies, err := agent.MCTS.Policies()
 		if err != nil {
-			return nil, err
+			return g, nil, chess.NoColor, err
 		}
 		ex := Example{
 			Board:  boards,
@@ -67,14 +110,22 @@ func (a *Arena) SelfPlay() (examples []Example, err error) {
 			// THIS IS A HACK.
 			// The value is 1 or -1 depending on player colour or draw 0,
 			// but for now we store the player colour for this turn.
-			Value: float32(a.game.Turn()),
+			Value: float32(g.Turn()),
 		}
 		if validPolicies(policies) {
 			examples = append(examples, ex)
 		}
-		a.game = a.game.Apply(best)
+		if record != nil {
+			record.annotate(g, best, agent.MCTS.SearchInfo(), policies)
+		}
+		g = g.Apply(best)
 	}
+	return g, examples, winner, nil
+}
 
+// labelExamples replaces the colour to move stored as value of the examples with the outcome of the game for
+// that colour.
+func labelExamples(examples []Example, winner chess.Color) {
 	for i := range examples {
 		switch {
 		case winner == chess.NoColor: // draw
@@ -85,17 +136,95 @@ func (a *Arena) SelfPlay() (examples []Example, err error) {
 			examples[i].Value = -1
 		}
 	}
+}
 
-	a.CurrentAgent.MCTS.Reset()
+// Play lets CandidateAgent play a match of games against CurrentAgent, alternating colours every game.
+// The games are played without root noise and random opening moves, see evalConf.
+// The results are returned from the perspective of CandidateAgent. Afterwards the game is back at its initial
+// position and CurrentAgent is ready for self-play again.
+func (a *Arena) Play(games int) (wins, draws, losses int, err error) {
+	if a.CandidateAgent == nil {
+		return 0, 0, 0, errors.New("no candidate agent in arena")
+	}
+	agents := []*Agent{a.CandidateAgent, a.CurrentAgent}
+	for _, agent := range agents {
+		if err = agent.SwitchToInference(); err != nil {
+			return
+		}
+	}
+	defer func() {
+		for _, agent := range agents {
+			if closeErr := agent.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+		a.game.Reset()
+		a.CurrentAgent.MCTS.Reset()
+		a.CurrentAgent.MCTS = mcts.New(a.game, a.conf, a.CurrentAgent)
+	}()
+
+	for i := 0; i < games; i++ {
+		a.CandidateAgent.Player, a.CurrentAgent.Player = chess.White, chess.Black
+		if i%2 == 1 {
+			a.CandidateAgent.Player, a.CurrentAgent.Player = chess.Black, chess.White
+		}
+
+		var winner chess.Color
+		if winner, err = a.playGame(agents); err != nil {
+			return
+		}
+		switch winner {
+		case chess.NoColor:
+			draws++
+		case a.CandidateAgent.Player:
+			wins++
+		default:
+			losses++
+		}
+		log.Printf("Evaluation game %d: candidate %v, winner %v", i+1, a.CandidateAgent.Player, winner)
+	}
+	return
+}
+
+// evalConf returns the search config of the evaluation matches: the self-play config with the Dirichlet noise and
+// the random opening moves turned off, so that the stronger agent wins rather than the luckier one.
+func (a *Arena) evalConf() mcts.Config {
+	conf := a.conf
+	conf.DisableNoise = true
+	conf.RandomCount = 0
+	return conf
+}
+
+// playGame plays one game between agents, each agent moving when it is its Player's turn, and returns the winner.
+func (a *Arena) playGame(agents []*Agent) (chess.Color, error) {
 	a.game.Reset()
+	conf := a.evalConf()
+	for _, agent := range agents {
+		if agent.MCTS != nil {
+			agent.MCTS.Reset()
+		}
+		agent.MCTS = mcts.New(a.game, conf, agent)
+	}
 	runtime.GC()
 
-	a.CurrentAgent.MCTS = mcts.New(a.game, a.conf, a.CurrentAgent)
-	if err := a.CurrentAgent.Close(); err != nil {
-		return nil, err
+	ended, winner := a.game.Ended()
+	for !ended {
+		agent := agents[0]
+		if agent.Player != a.game.Turn() {
+			agent = agents[1]
+		}
+		best, err := agent.Search(a.game)
+		if err != nil {
+			return chess.NoColor, err
+		}
+		if best == game.ResignMove {
+			// the agent to move has given up
+			return a.game.Turn().Other(), nil
+		}
+		a.game = a.game.Apply(best)
+		ended, winner = a.game.Ended()
 	}
-
-	return examples, nil
+	return winner, nil
 }
 
 // Name of the game
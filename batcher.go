@@ -0,0 +1,125 @@
+package agogo
+
+import (
+	"sync"
+	"time"
+
+	"github.com/alphabeth/game"
+	"github.com/pkg/errors"
+)
+
+// batchRequest is a leaf position waiting to be evaluated.
+type batchRequest struct {
+	board []float32
+	reply chan batchResult
+}
+
+type batchResult struct {
+	policy []float32
+	value  float32
+	err    error
+}
+
+// Batcher gathers the leaf positions of concurrent MCTS simulations and evaluates them together in one forward
+// pass of the neural network. A batch is run as soon as it holds maxBatch positions or when timeout has passed
+// since its first position arrived, whichever comes first.
+// Batcher implements mcts.Inferencer.
+type Batcher struct {
+	inf      BatchInferer
+	enc      GameEncoder
+	maxBatch int
+	timeout  time.Duration
+
+	requests  chan batchRequest
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewBatcher creates a Batcher evaluating positions encoded by enc with inf. maxBatch must not be larger than the
+// batch size the inferer supports. A batch is flushed once it is full or timeout after its first position arrived,
+// timeout must be positive as without any wait every batch would hold a single position.
+func NewBatcher(inf BatchInferer, enc GameEncoder, maxBatch int, timeout time.Duration) (*Batcher, error) {
+	if timeout <= 0 {
+		return nil, errors.Errorf("invalid batch timeout %v, batched inference needs a positive timeout", timeout)
+	}
+	if maxBatch < 1 {
+		maxBatch = 1
+	}
+	b := &Batcher{
+		inf:      inf,
+		enc:      enc,
+		maxBatch: maxBatch,
+		timeout:  timeout,
+		requests: make(chan batchRequest, maxBatch),
+		done:     make(chan struct{}),
+	}
+	go b.loop()
+	return b, nil
+}
+
+// Infer queues the position for the next batch and waits for its result.
+func (b *Batcher) Infer(g game.State) (policy []float32, value float32) {
+	return b.inferBoard(b.enc(g))
+}
+
+// inferBoard is Infer for a position that is already encoded.
+func (b *Batcher) inferBoard(board []float32) (policy []float32, value float32) {
+	req := batchRequest{
+		board: board,
+		reply: make(chan batchResult, 1),
+	}
+	b.requests <- req
+	res := <-req.reply
+	if res.err != nil {
+		if el, ok := b.inf.(ExecLogger); ok {
+			panic(errors.WithMessage(res.err, el.ExecLog()))
+		}
+		panic(res.err)
+	}
+	return res.policy, res.value
+}
+
+// Close stops the batcher and closes the underlying inferer. Infer must not be called after Close.
+func (b *Batcher) Close() error {
+	b.closeOnce.Do(func() { close(b.requests) })
+	<-b.done
+	return b.inf.Close()
+}
+
+func (b *Batcher) loop() {
+	defer close(b.done)
+	for req := range b.requests {
+		batch := []batchRequest{req}
+		timer := time.NewTimer(b.timeout)
+	collect:
+		for len(batch) < b.maxBatch {
+			select {
+			case r, ok := <-b.requests:
+				if !ok {
+					break collect
+				}
+				batch = append(batch, r)
+			case <-timer.C:
+				break collect
+			}
+		}
+		timer.Stop()
+		b.flush(batch)
+	}
+}
+
+// flush runs a forward pass on the batch and hands each result back to its waiting simulation.
+func (b *Batcher) flush(batch []batchRequest) {
+	boards := make([][]float32, len(batch))
+	for i, req := range batch {
+		boards[i] = req.board
+	}
+	policies, values, err := b.inf.InferBatch(boards)
+	for i, req := range batch {
+		if err != nil {
+			req.reply <- batchResult{err: err}
+			continue
+		}
+		req.reply <- batchResult{policy: policies[i], value: values[i]}
+	}
+}
@@ -0,0 +1,159 @@
+package agogo
+
+import (
+	"container/list"
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"sync"
+	"sync/atomic"
+
+	dual "github.com/alphabeth/dualnet"
+)
+
+// CacheStats are the usage statistics of an EvalCache.
+type CacheStats struct {
+	Hits    uint64
+	Misses  uint64
+	Entries int // number of cached positions
+	Size    int // maximum number of cached positions
+}
+
+// HitRate returns the fraction of lookups answered from the cache.
+func (s CacheStats) HitRate() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+// cacheEntry is a cached evaluation of a position.
+type cacheEntry struct {
+	key    [16]byte
+	policy []float32
+	value  float32
+}
+
+// EvalCache holds the network evaluations of the most recently used positions, keyed by a hash of their encoded
+// input planes, so that transpositions and positions seen by earlier searches are not evaluated again.
+// Positions are only shared when the network sees the same input, with an encoder using the history of a game the
+// same board reached through another history is a different entry.
+// EvalCache is safe for concurrent use.
+type EvalCache struct {
+	sync.Mutex
+	size    int
+	entries map[[16]byte]*list.Element
+	lru     *list.List // most recently used first
+
+	// network and version of its weights the cached evaluations were made with
+	nn      *dual.Dual
+	version uint64
+
+	hits, misses uint64 // atomic
+}
+
+// NewEvalCache creates a cache holding at most size positions.
+func NewEvalCache(size int) *EvalCache {
+	if size < 1 {
+		size = 1
+	}
+	return &EvalCache{
+		size:    size,
+		entries: make(map[[16]byte]*list.Element, size),
+		lru:     list.New(),
+	}
+}
+
+// inputKey returns the cache key of the encoded input planes of a position.
+func inputKey(input []float32) [16]byte {
+	buf := make([]byte, 4*len(input))
+	for i, v := range input {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	h := fnv.New128a()
+	h.Write(buf)
+	var key [16]byte
+	h.Sum(key[:0])
+	return key
+}
+
+// Get returns the cached evaluation of the encoded position input. The returned policy must not be modified.
+func (c *EvalCache) Get(input []float32) (policy []float32, value float32, ok bool) {
+	key := inputKey(input)
+	c.Lock()
+	el, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(el)
+		e := el.Value.(*cacheEntry)
+		policy, value = e.policy, e.value
+	}
+	c.Unlock()
+
+	if ok {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+	return policy, value, ok
+}
+
+// Put caches the evaluation of the encoded position input, evicting the least recently used position when the
+// cache is full. The policy is copied, so buffers reused by the network can be passed.
+func (c *EvalCache) Put(input []float32, policy []float32, value float32) {
+	key := inputKey(input)
+	e := &cacheEntry{
+		key:    key,
+		policy: append([]float32(nil), policy...),
+		value:  value,
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// Reset empties the cache, e.g. when the weights of the network have changed. The statistics are kept.
+func (c *EvalCache) Reset() {
+	c.Lock()
+	c.entries = make(map[[16]byte]*list.Element, c.size)
+	c.lru.Init()
+	c.Unlock()
+}
+
+// setWeights empties the cache unless its evaluations were made with the given version of the weights of nn.
+// Agents sharing a cache call it whenever they switch to inference, so it is only emptied once per change of the
+// weights.
+func (c *EvalCache) setWeights(nn *dual.Dual, version uint64) {
+	c.Lock()
+	defer c.Unlock()
+	if c.nn == nn && c.version == version {
+		return
+	}
+	c.nn, c.version = nn, version
+	c.entries = make(map[[16]byte]*list.Element, c.size)
+	c.lru.Init()
+}
+
+// Stats returns the usage statistics of the cache.
+func (c *EvalCache) Stats() CacheStats {
+	c.Lock()
+	entries := c.lru.Len()
+	c.Unlock()
+	return CacheStats{
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+		Entries: entries,
+		Size:    c.size,
+	}
+}
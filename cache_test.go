@@ -0,0 +1,169 @@
+package agogo
+
+import (
+	"sync"
+	"testing"
+
+	dual "github.com/alphabeth/dualnet"
+	"github.com/alphabeth/game"
+	"github.com/stretchr/testify/assert"
+)
+
+// openings returns the encoded positions after each legal first move.
+func openings(t *testing.T) [][]float32 {
+	start := game.ChessGameAZ()
+	var inputs [][]float32
+	for _, idx := range start.PossibleMoves() {
+		m, err := start.NNToMove(idx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, game.InputEncoder(start.Clone().Apply(m)))
+	}
+	return inputs
+}
+
+func TestEvalCacheEviction(t *testing.T) {
+	assert := assert.New(t)
+	inputs := openings(t)
+	c := NewEvalCache(3)
+	for i, s := range inputs[:3] {
+		c.Put(s, []float32{float32(i)}, float32(i))
+	}
+	// inputs[0] becomes the most recently used, inputs[1] the least
+	_, _, ok := c.Get(inputs[0])
+	assert.True(ok)
+	c.Put(inputs[3], []float32{3}, 3)
+
+	_, _, ok = c.Get(inputs[1])
+	assert.False(ok, "least recently used position not evicted")
+	for _, i := range []int{0, 2, 3} {
+		policy, value, ok := c.Get(inputs[i])
+		if assert.True(ok, "position %d evicted", i) {
+			assert.Equal([]float32{float32(i)}, policy)
+			assert.Equal(float32(i), value)
+		}
+	}
+	assert.Equal(3, c.Stats().Entries)
+
+	// updating a cached position does not grow the cache
+	c.Put(inputs[0], []float32{10}, 10)
+	policy, _, _ := c.Get(inputs[0])
+	assert.Equal([]float32{10}, policy)
+	assert.Equal(3, c.Stats().Entries)
+}
+
+func TestEvalCachePutCopies(t *testing.T) {
+	inputs := openings(t)
+	c := NewEvalCache(1)
+	policy := []float32{1, 2}
+	c.Put(inputs[0], policy, 0)
+	policy[0] = 5
+	cached, _, _ := c.Get(inputs[0])
+	assert.Equal(t, []float32{1, 2}, cached)
+}
+
+func TestEvalCacheStats(t *testing.T) {
+	assert := assert.New(t)
+	inputs := openings(t)
+	c := NewEvalCache(10)
+	assert.Equal(0.0, c.Stats().HitRate())
+
+	c.Put(inputs[0], []float32{0}, 0)
+	c.Get(inputs[0])
+	c.Get(inputs[0])
+	c.Get(inputs[0])
+	c.Get(inputs[1])
+
+	stats := c.Stats()
+	assert.Equal(uint64(3), stats.Hits)
+	assert.Equal(uint64(1), stats.Misses)
+	assert.Equal(1, stats.Entries)
+	assert.Equal(10, stats.Size)
+	assert.Equal(0.75, stats.HitRate())
+
+	c.Reset()
+	stats = c.Stats()
+	assert.Equal(0, stats.Entries)
+	assert.Equal(uint64(3), stats.Hits, "statistics are kept on reset")
+}
+
+func TestEvalCacheConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	inputs := openings(t)
+	const size = 8
+	c := NewEvalCache(size)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				s := inputs[(w+i)%len(inputs)]
+				if policy, value, ok := c.Get(s); ok {
+					// the evaluation of a position is never mixed with another one
+					assert.Equal(value, policy[0])
+					continue
+				}
+				v := float32((w + i) % len(inputs))
+				c.Put(s, []float32{v}, v)
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	stats := c.Stats()
+	assert.Equal(uint64(8*200), stats.Hits+stats.Misses)
+	assert.True(stats.Entries <= size)
+}
+
+func TestEvalCacheSetWeights(t *testing.T) {
+	assert := assert.New(t)
+	inputs := openings(t)
+	nn := &dual.Dual{}
+	c := NewEvalCache(4)
+	c.setWeights(nn, 1)
+	c.Put(inputs[0], []float32{0}, 0)
+
+	c.setWeights(nn, 1)
+	assert.Equal(1, c.Stats().Entries, "emptied although the weights did not change")
+	c.setWeights(nn, 2)
+	assert.Equal(0, c.Stats().Entries)
+
+	c.Put(inputs[0], []float32{0}, 0)
+	c.setWeights(&dual.Dual{}, 2)
+	assert.Equal(0, c.Stats().Entries)
+}
+
+func TestEvalCacheHistory(t *testing.T) {
+	assert := assert.New(t)
+	play := func(moves ...game.Move) game.State {
+		g := game.ChessGameAZ()
+		for _, m := range moves {
+			g.Apply(m)
+		}
+		return g
+	}
+	// the same board reached through two move orders
+	a := play("e2e4", "e7e5", "g1f3")
+	b := play("g1f3", "e7e5", "e2e4")
+	assert.Equal(a.FEN(), b.FEN())
+
+	// without history both are the same input and share an entry
+	c := NewEvalCache(4)
+	c.Put(game.InputEncoder(a), []float32{1}, 1)
+	_, _, ok := c.Get(game.InputEncoder(b))
+	assert.True(ok)
+
+	// with history they are different inputs
+	enc := game.HistoryEncoder{T: game.HistoryLength}
+	c = NewEvalCache(4)
+	c.Put(enc.Encode(a), []float32{1}, 1)
+	_, _, ok = c.Get(enc.Encode(b))
+	assert.False(ok, "positions with different histories share an entry")
+	policy, _, ok := c.Get(enc.Encode(a))
+	if assert.True(ok) {
+		assert.Equal([]float32{1}, policy)
+	}
+}
@@ -0,0 +1,146 @@
+package agogo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/alphabeth/internal/atomicfile"
+	"github.com/pkg/errors"
+)
+
+// constant variables for training checkpoints.
+const (
+	progressFile     = "progress.json"
+	replayBufferFile = "replay.gob"
+	checkpointPrefix = "iter-"
+)
+
+// Progress is the training position stored with every checkpoint.
+// The per weight state of the momentum, Adam and RMSProp solvers is not stored, a resumed training starts these
+// solvers cold and only the learn rate schedule continues from TrainSteps.
+type Progress struct {
+	Iteration        int `json:"iteration"`         // number of finished training iterations
+	ReplayGeneration int `json:"replay_generation"` // current generation of the replay buffer
+	ReplayGames      int `json:"replay_games"`      // number of games in the replay buffer
+	TrainSteps       int `json:"train_steps"`       // optimisation steps of the network, for the learn rate schedule
+}
+
+// checkpointName returns the directory name of the checkpoint written after iteration.
+func checkpointName(iteration int) string {
+	return fmt.Sprintf("%s%06d", checkpointPrefix, iteration)
+}
+
+// Checkpoint writes the model, the replay buffer and the training progress into a numbered subdirectory of dir.
+// The progress file is written last, a checkpoint without it is incomplete and ignored by Resume.
+func (a *AZ) Checkpoint(dir string) error {
+	path := filepath.Join(dir, checkpointName(a.iteration))
+	if err := a.SaveAZ(path); err != nil {
+		return errors.WithMessage(err, "saving model")
+	}
+	if err := a.Replay.Save(filepath.Join(path, replayBufferFile)); err != nil {
+		return errors.WithMessage(err, "saving replay buffer")
+	}
+
+	progress := Progress{
+		Iteration:        a.iteration,
+		ReplayGeneration: a.Replay.Generation(),
+		ReplayGames:      a.Replay.Games(),
+		TrainSteps:       a.CurrentAgent.NN.TrainSteps(),
+	}
+	jsonStr, err := json.MarshalIndent(progress, "", "	")
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(filepath.Join(path, progressFile), 0644, func(w io.Writer) error {
+		_, err := w.Write(jsonStr)
+		return err
+	})
+}
+
+// checkpointIterations returns the iterations of the checkpoint directories in dir, most recent first.
+func checkpointIterations(dir string) ([]int, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var iterations []int
+	for _, info := range infos {
+		var iteration int
+		if !info.IsDir() {
+			continue
+		}
+		if _, err := fmt.Sscanf(info.Name(), checkpointPrefix+"%d", &iteration); err != nil {
+			continue
+		}
+		if info.Name() != checkpointName(iteration) {
+			continue
+		}
+		iterations = append(iterations, iteration)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(iterations)))
+	return iterations, nil
+}
+
+// pruneCheckpoints deletes all but the keep most recent checkpoints in dir.
+func pruneCheckpoints(dir string, keep int) error {
+	iterations, err := checkpointIterations(dir)
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(iterations); i++ {
+		if err := os.RemoveAll(filepath.Join(dir, checkpointName(iterations[i]))); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// latestCheckpoint returns the path and progress of the most recent complete checkpoint in dir.
+func latestCheckpoint(dir string) (string, Progress, error) {
+	var progress Progress
+	iterations, err := checkpointIterations(dir)
+	if err != nil {
+		return "", progress, err
+	}
+
+	for _, iteration := range iterations {
+		path := filepath.Join(dir, checkpointName(iteration))
+		jsonStr, err := ioutil.ReadFile(filepath.Join(path, progressFile))
+		if err != nil {
+			continue // incomplete checkpoint
+		}
+		if err := json.Unmarshal(jsonStr, &progress); err != nil {
+			return "", progress, errors.WithMessage(err, fmt.Sprintf("reading progress of %s", path))
+		}
+		return path, progress, nil
+	}
+	return "", progress, errors.Errorf("no checkpoint found in %s", dir)
+}
+
+// Resume restores the network, the replay buffer and the iteration counter from the latest checkpoint in dir.
+// Further checkpoints are written into dir as well. The solver state is not restored, see Progress.
+func (a *AZ) Resume(dir string) error {
+	path, progress, err := latestCheckpoint(dir)
+	if err != nil {
+		return err
+	}
+	if err := a.Load(filepath.Join(path, modelFile)); err != nil {
+		return errors.WithMessage(err, "loading model")
+	}
+	replay, err := LoadReplayBuffer(filepath.Join(path, replayBufferFile), a.Replay.ReplayConfig)
+	if err != nil {
+		return errors.WithMessage(err, "loading replay buffer")
+	}
+
+	a.Replay = replay
+	a.iteration = progress.Iteration
+	a.CurrentAgent.NN.SetTrainSteps(progress.TrainSteps)
+	a.checkpointDir = dir
+	return nil
+}
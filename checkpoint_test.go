@@ -0,0 +1,124 @@
+package agogo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	dual "github.com/alphabeth/dualnet"
+	"github.com/alphabeth/game"
+	"github.com/alphabeth/mcts"
+	"github.com/stretchr/testify/assert"
+)
+
+// testConfig returns the config of a small network playing g.
+func testConfig(g *game.Chess) Config {
+	enc := game.SimpleEncoder{}
+	nnConf := dual.DefaultConf(game.RowNum, game.ColNum, g.ActionSpace())
+	nnConf.K = 4
+	nnConf.SharedLayers = 1
+	nnConf.FC = 8
+	nnConf.BatchSize = 2
+	nnConf.Features = enc.Info().Planes
+
+	mctsConf := mcts.DefaultConfig()
+	mctsConf.NumSimulation = 2
+	mctsConf.RandomTemperature = 1
+	mctsConf.MaxDepth = 10
+
+	return Config{
+		Name:        "test",
+		NNConf:      nnConf,
+		MCTSConf:    mctsConf,
+		Replay:      ReplayConfig{MaxGenerations: 3},
+		Encoder:     enc.Encode,
+		EncoderInfo: enc.Info(),
+	}
+}
+
+// testGame returns examples of a game with n positions, all with value v.
+func testGame(n int, v float32) []Example {
+	examples := make([]Example, n)
+	for i := range examples {
+		examples[i] = Example{Board: []float32{float32(i)}, Policy: []float32{1}, Value: v}
+	}
+	return examples
+}
+
+func TestResume(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := testConfig(game.ChessGameAZ())
+	conf.CheckpointDir = dir
+	a := New(game.ChessGameAZ(), conf)
+	for i := 0; i < 2; i++ {
+		a.Replay.Add(testGame(3, float32(i)))
+		if err := a.endIteration(); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	a.CurrentAgent.NN.SetTrainSteps(42)
+	a.Replay.Add(testGame(5, 2))
+	if err := a.endIteration(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	// not checkpointed
+	a.Replay.Add(testGame(7, 3))
+	// incomplete checkpoints are skipped
+	if err := os.Mkdir(filepath.Join(dir, checkpointName(9)), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	b := New(game.ChessGameAZ(), testConfig(game.ChessGameAZ()))
+	if err := b.Resume(dir); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assert.Equal(3, b.Iteration())
+	assert.Equal(3, b.Replay.Generation())
+	assert.Equal(2, b.Replay.Games()) // the game of generation 0 is out of the window
+	assert.Equal(8, b.Replay.Len())
+	assert.Equal(42, b.CurrentAgent.NN.TrainSteps())
+
+	// training continues in the same directory
+	b.Replay.Add(testGame(1, 0))
+	if err := b.endIteration(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	path, progress, err := latestCheckpoint(dir)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assert.Equal(filepath.Join(dir, checkpointName(4)), path)
+	assert.Equal(4, progress.Iteration)
+	assert.Equal(2, progress.ReplayGames)
+}
+
+func TestPruneCheckpoints(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "checkpoints")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	conf := testConfig(game.ChessGameAZ())
+	conf.CheckpointDir = dir
+	conf.KeepCheckpoints = 2
+	a := New(game.ChessGameAZ(), conf)
+	for i := 0; i < 4; i++ {
+		if err := a.endIteration(); err != nil {
+			t.Fatalf("%+v", err)
+		}
+	}
+	iterations, err := checkpointIterations(dir)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assert.Equal([]int{4, 3}, iterations)
+}
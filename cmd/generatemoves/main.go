@@ -1,53 +1,183 @@
 // This package is for generating nearly all possible moves and write them into file for model to read and
 // encodes each of them as one hot encoding.
+//
+// By default the moves are collected by playing random games. With -exhaustive every geometrically possible UCI
+// move is enumerated instead. Either way only the moves missing from the file are added, in sorted order after the
+// moves already in it.
+//
+// The line of a move is its neural network index, so the existing lines are never reordered and networks trained
+// with the old file keep working with the new one.
 
 package main
 
 import (
+	"bufio"
 	"flag"
+	"io"
 	"log"
 	"math/rand"
 	"os"
+	"sort"
 
+	"github.com/alphabeth/internal/atomicfile"
 	"github.com/notnil/chess"
 )
 
 var (
 	numGameFlag   = flag.Int("num_game", 10, "number of game to play")
-	chessMovePath = flag.String("path", "chess_moves.txt", "chess possible moves path to generate to")
+	chessMovePath = flag.String("path", "chess_moves.txt", "chess possible moves path to generate to, new moves are appended to an existing file")
+	exhaustive    = flag.Bool("exhaustive", false, "enumerate every geometrically possible move instead of playing random games")
+	report        = flag.Bool("report", false, "report the coverage of num_game random games against the exhaustive enumeration")
 )
 
+// promotionPieces are the UCI promotion suffixes.
+var promotionPieces = []string{"q", "r", "b", "n"}
+
 func main() {
 	flag.Parse()
 
-	// If the file doesn't exist, create it, or append to the file
-	f, err := os.OpenFile(*chessMovePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	lines, err := readMoves(*chessMovePath)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer f.Close()
 
-	movesMap := make(map[string]struct{}, 0)
-	for i := 0; i < *numGameFlag; i++ {
+	var generated map[string]struct{}
+	if *exhaustive {
+		generated = enumerateMoves()
+	} else {
+		generated = randomMoves(*numGameFlag)
+	}
+
+	added := newMoves(lines, generated)
+	if err := writeMoves(*chessMovePath, append(lines, added...)); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("generated %d moves, %d of them new, %d moves in %s", len(generated), len(added), len(lines)+len(added), *chessMovePath)
+	if *report {
+		random := generated
+		if *exhaustive {
+			random = randomMoves(*numGameFlag)
+		}
+		coverageReport(enumerateMoves(), random)
+	}
+}
+
+// enumerateMoves returns every UCI move a piece could make on an empty board: all from/to pairs reachable by a
+// queen or a knight, and every promotion of a pawn reaching the last rank straight or diagonally.
+func enumerateMoves() map[string]struct{} {
+	moves := make(map[string]struct{})
+	for from := chess.A1; from <= chess.H8; from++ {
+		for to := chess.A1; to <= chess.H8; to++ {
+			if from == to {
+				continue
+			}
+			df := abs(int(to.File()) - int(from.File()))
+			dr := abs(int(to.Rank()) - int(from.Rank()))
+			queen := df == 0 || dr == 0 || df == dr
+			knight := (df == 1 && dr == 2) || (df == 2 && dr == 1)
+			if !queen && !knight {
+				continue
+			}
+			m := from.String() + to.String()
+			moves[m] = struct{}{}
+
+			white := from.Rank() == chess.Rank7 && to.Rank() == chess.Rank8
+			black := from.Rank() == chess.Rank2 && to.Rank() == chess.Rank1
+			if (white || black) && df <= 1 {
+				for _, p := range promotionPieces {
+					moves[m+p] = struct{}{}
+				}
+			}
+		}
+	}
+	return moves
+}
+
+// randomMoves returns the valid moves seen while playing games with random moves.
+func randomMoves(games int) map[string]struct{} {
+	moves := make(map[string]struct{})
+	for i := 0; i < games; i++ {
 		game := chess.NewGame()
 		// generate moves until game is over
 		for game.Outcome() == chess.NoOutcome {
-			// select a random move
-			moves := game.ValidMoves()
-			for _, m := range moves {
-				mStr := m.String()
-				if _, ok := movesMap[mStr]; !ok {
-					movesMap[mStr] = struct{}{}
-					if _, err := f.Write([]byte(mStr + "\n")); err != nil {
-						log.Fatal(err)
-					}
-				}
+			valid := game.ValidMoves()
+			for _, m := range valid {
+				moves[m.String()] = struct{}{}
 			}
-			move := moves[rand.Intn(len(moves))]
+			// select a random move
+			move := valid[rand.Intn(len(valid))]
 			if err := game.Move(move); err != nil {
 				log.Fatal(err)
 			}
 		}
 	}
+	return moves
+}
 
+// coverageReport logs how much of the exhaustive enumeration random play finds.
+func coverageReport(all, random map[string]struct{}) {
+	var covered int
+	for m := range random {
+		if _, ok := all[m]; ok {
+			covered++
+		}
+	}
+	log.Printf("%d random games found %d of %d possible moves (%.1f%%)",
+		*numGameFlag, covered, len(all), 100*float64(covered)/float64(len(all)))
+	if missing := len(all) - covered; missing > 0 {
+		log.Printf("%d moves are only found by the exhaustive enumeration", missing)
+	}
+}
+
+// readMoves reads the lines of path, a missing file has none.
+func readMoves(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+// newMoves returns the moves of generated which are not in lines, sorted.
+func newMoves(lines []string, generated map[string]struct{}) []string {
+	existing := make(map[string]struct{}, len(lines))
+	for _, m := range lines {
+		existing[m] = struct{}{}
+	}
+	var added []string
+	for m := range generated {
+		if _, ok := existing[m]; !ok {
+			added = append(added, m)
+		}
+	}
+	sort.Strings(added)
+	return added
+}
+
+// writeMoves replaces path with the moves, one per line.
+func writeMoves(path string, moves []string) error {
+	return atomicfile.Write(path, 0644, func(w io.Writer) error {
+		bw := bufio.NewWriter(w)
+		for _, m := range moves {
+			bw.WriteString(m + "\n")
+		}
+		return bw.Flush()
+	})
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEnumerateMoves(t *testing.T) {
+	moves := enumerateMoves()
+	if len(moves) != 1968 {
+		t.Errorf("Expected 1968 moves. Got %d", len(moves))
+	}
+	for _, m := range []string{"e2e4", "g1f3", "e1g1", "a7a8q", "b2a1n", "h8a1"} {
+		if _, ok := moves[m]; !ok {
+			t.Errorf("Expected %s to be enumerated", m)
+		}
+	}
+	for _, m := range []string{"e2e2", "a1b3q", "e4e5q", "a1c2r"} {
+		if _, ok := moves[m]; ok {
+			t.Errorf("Expected %s not to be enumerated", m)
+		}
+	}
+}
+
+func TestWriteMoves(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generatemoves")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "moves.txt")
+	lines, err := readMoves(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 0 {
+		t.Errorf("Expected no moves in a missing file. Got %v", lines)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("g1f3\ne2e4\na7a8q\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if lines, err = readMoves(path); err != nil {
+		t.Fatal(err)
+	}
+	generated := map[string]struct{}{"e2e4": {}, "d2d4": {}, "b1c3": {}}
+	added := newMoves(lines, generated)
+	if err := writeMoves(path, append(lines, added...)); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the existing moves keep their lines, the new ones follow sorted and without duplicates
+	expected := "g1f3\ne2e4\na7a8q\nb1c3\nd2d4\n"
+	if string(data) != expected {
+		t.Errorf("Expected %q. Got %q", expected, data)
+	}
+}
@@ -5,17 +5,16 @@ import (
 	"fmt"
 
 	agogo "github.com/alphabeth"
-	"github.com/alphabeth/game"
 )
 
 var (
-	fileMoves = flag.String("moves_file", "", "file containing chess moves")
+	fileMoves = flag.String("moves_file", "", "file containing chess moves, checked against the checkpoint if given")
 	dirName   = flag.String("model_path", "", "directory contains trained model")
 )
 
 func main() {
 	flag.Parse()
-	az, err := agogo.Load(*dirName, *fileMoves, game.InputEncoder)
+	az, err := agogo.Load(*dirName, *fileMoves, nil)
 	if err != nil {
 		fmt.Printf("error loading model: %s\n", err)
 	}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	agogo "github.com/alphabeth"
+	dual "github.com/alphabeth/dualnet"
+	"github.com/alphabeth/game"
+	"github.com/alphabeth/mcts"
+)
+
+var (
+	pgnFile   = flag.String("pgn_file", "", "PGN file containing games to pre-train on")
+	fileMoves = flag.String("moves_file", "", "file containing chess moves, leave empty to use AlphaZero 8x8x73 move encoding")
+	modelPath = flag.String("model_path", "alphabeth", "Model checkpoint directory")
+	epochs    = flag.Int("epochs", 5, "number of passes over the PGN examples")
+)
+
+func main() {
+	flag.Parse()
+
+	var g *game.Chess
+	if *fileMoves == "" {
+		g = game.ChessGameAZ()
+	} else {
+		g = game.ChessGame(*fileMoves)
+	}
+
+	// pretraining does not search, the default search config is only stored with the checkpoint
+	conf := agogo.Config{
+		Name:     "Alphabeth",
+		NNConf:   dual.DefaultConf(game.RowNum, game.ColNum, g.ActionSpace()),
+		MCTSConf: mcts.DefaultConfig(),
+	}
+
+	enc := game.HistoryEncoder{T: game.HistoryLength}
+	conf.NNConf.BatchSize = 20
+	conf.NNConf.Features = enc.Planes()
+	conf.NNConf.K = 3
+	conf.NNConf.SharedLayers = 3
+
+	conf.Encoder = enc.Encode
+	conf.EncoderInfo = enc.Info()
+
+	f, err := os.Open(*pgnFile)
+	if err != nil {
+		log.Fatalf("error when opening pgn file: %s", err)
+	}
+	examples, err := agogo.ExamplesFromPGN(f, g, conf.Encoder)
+	f.Close()
+	if err != nil {
+		log.Fatalf("error when reading pgn file: %s", err)
+	}
+
+	a := agogo.New(g, conf)
+	if err := a.Pretrain(examples, *epochs); err != nil {
+		log.Fatalf("error when pre-training: %s", err)
+	}
+
+	log.Printf("Save model")
+	if err := a.SaveAZ(*modelPath); err != nil {
+		log.Fatalf("error when saving model: %s", err)
+	}
+}
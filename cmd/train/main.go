@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"log"
+	"os"
 
 	agogo "github.com/alphabeth"
 	dual "github.com/alphabeth/dualnet"
@@ -11,14 +12,26 @@ import (
 )
 
 var (
-	fileMoves = flag.String("moves_file", "", "file containing chess moves")
+	fileMoves = flag.String("moves_file", "", "file containing chess moves, leave empty to use AlphaZero 8x8x73 move encoding")
 	modelPath = flag.String("model_path", "alphabeth", "Model checkpoint directory")
+	pgnFile   = flag.String("pgn_file", "", "file to write self-play games to in PGN format")
+	arena     = flag.Int("arena_games", 0, "number of evaluation games a trained candidate plays against the best agent, 0 keeps the latest model without evaluation")
+	workers   = flag.Int("self_play_workers", 1, "number of self-play games played concurrently")
+	ckptDir   = flag.String("checkpoint_dir", "", "directory receiving a checkpoint after every iteration")
+	keepCkpts = flag.Int("keep_checkpoints", 3, "number of most recent checkpoints kept in checkpoint_dir, 0 keeps all")
+	resume    = flag.Bool("resume", false, "continue training from the latest checkpoint in checkpoint_dir")
+	replay    = flag.String("replay_file", "", "file the replay buffer is loaded from, if it exists, and saved to after training")
 )
 
 func main() {
 	flag.Parse()
 
-	g := game.ChessGame(*fileMoves)
+	var g *game.Chess
+	if *fileMoves == "" {
+		g = game.ChessGameAZ()
+	} else {
+		g = game.ChessGame(*fileMoves)
+	}
 
 	conf := agogo.Config{
 		Name:            "Alphabeth",
@@ -27,25 +40,94 @@ func main() {
 		UpdateThreshold: 0.55,
 	}
 
+	enc := game.HistoryEncoder{T: game.HistoryLength}
 	conf.NNConf.BatchSize = 20
-	conf.NNConf.Features = 2 // write a better encoding of the board, and increase features (and that allows you to increase K as well)
+	conf.NNConf.Features = enc.Planes()
 	conf.NNConf.K = 3
 	conf.NNConf.SharedLayers = 3
+	conf.NNConf.Train = dual.TrainConfig{
+		Solver:      dual.MomentumSolver,
+		LearnRate:   0.02,
+		Momentum:    0.9,
+		Schedule:    dual.StepSchedule,
+		StepSize:    1000,
+		StepGamma:   0.1,
+		WeightDecay: 1e-4,
+		ClipNorm:    10,
+	}
 	conf.MCTSConf = mcts.Config{
 		PUCT:              1.5,
 		RandomCount:       10,
 		MaxDepth:          10000,
 		NumSimulation:     10,
 		RandomTemperature: 10,
+		Epsilon:           0.25,
+		DirichletParam:    0.3,
+		VirtualLoss:       1,
+	}
+	conf.Replay = agogo.ReplayConfig{
+		MaxGenerations: 5,
+		Sampling:       agogo.RecencySampling,
+		Decay:          0.8,
 	}
 
-	conf.Encoder = game.InputEncoder
+	conf.Encoder = enc.Encode
+	conf.EncoderInfo = enc.Info()
+	conf.SelfPlayWorkers = *workers
+	conf.EvalCacheSize = 1 << 16
+	conf.CheckpointDir = *ckptDir
+	conf.KeepCheckpoints = *keepCkpts
 
 	a := agogo.New(g, conf)
-	if err := a.LearnAZ(1, 5, 5); err != nil {
+	a.Metrics = func(m agogo.TrainMetrics) {
+		if m.EpochEnd {
+			log.Printf("Iteration %d epoch %d: loss %.4f (policy %.4f, value %.4f), entropy %.3f, lr %g, grad norm %.3f",
+				m.Iteration, m.Epoch, m.Loss, m.PolicyLoss, m.ValueLoss, m.PolicyEntropy, m.LearnRate, m.GradNorm)
+		}
+	}
+	if *pgnFile != "" {
+		f, err := os.Create(*pgnFile)
+		if err != nil {
+			log.Fatalf("error when creating pgn file: %s", err)
+		}
+		defer f.Close()
+		a.PGN = f
+	}
+	if *replay != "" {
+		if _, err := os.Stat(*replay); err == nil {
+			buf, err := agogo.LoadReplayBuffer(*replay, conf.Replay)
+			if err != nil {
+				log.Fatalf("error when loading replay buffer: %s", err)
+			}
+			log.Printf("Loaded %d games from replay buffer", buf.Games())
+			a.Replay = buf
+		}
+	}
+	if *resume {
+		if *ckptDir == "" {
+			log.Fatalf("resume needs a checkpoint_dir")
+		}
+		if err := a.Resume(*ckptDir); err != nil {
+			log.Fatalf("error when resuming training: %s", err)
+		}
+		log.Printf("Resumed training after iteration %d", a.Iteration())
+	}
+	var err error
+	if *arena > 0 {
+		err = a.Learn(1, 5, 5, *arena)
+	} else {
+		err = a.LearnAZ(1, 5, 5)
+	}
+	if err != nil {
 		log.Fatalf("error when learning chess: %s", err)
 	}
 
+	if *replay != "" {
+		if err := a.Replay.Save(*replay); err != nil {
+			log.Fatalf("error when saving replay buffer: %s", err)
+		}
+	}
+
 	log.Printf("Save model")
 	if err := a.SaveAZ(*modelPath); err != nil {
 		log.Fatalf("error when saving model: %s", err)
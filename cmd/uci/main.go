@@ -0,0 +1,288 @@
+// This package wraps a trained Alphabeth checkpoint as an engine speaking the Universal Chess Interface
+// over stdin/stdout, so it can be loaded into any chess GUI or match runner.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	agogo "github.com/alphabeth"
+	"github.com/alphabeth/game"
+	"github.com/alphabeth/mcts"
+	"github.com/notnil/chess"
+)
+
+var (
+	fileMoves = flag.String("moves_file", "", "file containing chess moves, checked against the checkpoint if given")
+	dirName   = flag.String("model_path", "", "directory contains trained model")
+	cacheSize = flag.Int("cache_size", 1<<18, "number of position evaluations kept between searches, 0 disables the cache")
+)
+
+const (
+	engineName   = "Alphabeth"
+	engineAuthor = "Alphabeth authors"
+	movesToGo    = 30                    // assumed number of moves left when only the clock is given
+	timeMargin   = 50 * time.Millisecond // time kept back for communication overhead
+	infoInterval = time.Second           // how often search progress is reported
+)
+
+type engine struct {
+	az  *agogo.AZ
+	out io.Writer
+
+	outLock sync.Mutex
+	state   *game.Chess
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func main() {
+	flag.Parse()
+	log.SetOutput(os.Stderr)
+
+	az, err := agogo.Load(*dirName, *fileMoves, nil)
+	if err != nil {
+		log.Fatalf("error loading model: %s", err)
+	}
+	// play the best move instead of sampling, without exploration noise.
+	az.CurrentAgent.MCTS.RandomCount = 0
+	az.CurrentAgent.MCTS.DisableNoise = true
+	if *cacheSize > 0 {
+		az.CurrentAgent.Cache = agogo.NewEvalCache(*cacheSize)
+	}
+	if err := az.CurrentAgent.SwitchToInference(); err != nil {
+		log.Fatalf("error switching to inference: %s", err)
+	}
+
+	e := &engine{az: az, out: os.Stdout}
+	if e.state, err = az.State().(*game.Chess).FromFEN(game.StartFEN); err != nil {
+		log.Fatal(err)
+	}
+	e.run(os.Stdin)
+}
+
+func (e *engine) run(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "uci":
+			e.send("id name %s", engineName)
+			e.send("id author %s", engineAuthor)
+			e.send("uciok")
+		case "isready":
+			e.send("readyok")
+		case "ucinewgame":
+			e.stopSearch()
+			e.newTree()
+		case "position":
+			e.stopSearch()
+			if err := e.position(fields[1:]); err != nil {
+				log.Printf("invalid position command: %s", err)
+			}
+		case "go":
+			e.stopSearch()
+			e.search(e.parseGo(fields[1:]))
+		case "stop":
+			e.stopSearch()
+		case "quit":
+			e.stopSearch()
+			return
+		default:
+			log.Printf("unknown command: %s", fields[0])
+		}
+	}
+	e.stopSearch()
+}
+
+// send writes a line to the GUI.
+func (e *engine) send(format string, args ...interface{}) {
+	e.outLock.Lock()
+	fmt.Fprintf(e.out, format+"\n", args...)
+	e.outLock.Unlock()
+}
+
+// position handles "position startpos|fen <fen> [moves <move>...]".
+func (e *engine) position(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing position")
+	}
+	fen := game.StartFEN
+	rest := args[1:]
+	switch args[0] {
+	case "startpos":
+	case "fen":
+		i := 0
+		for i < len(rest) && rest[i] != "moves" {
+			i++
+		}
+		fen = strings.Join(rest[:i], " ")
+		rest = rest[i:]
+	default:
+		return fmt.Errorf("unknown position type %q", args[0])
+	}
+
+	state, err := e.az.State().(*game.Chess).FromFEN(fen)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 && rest[0] == "moves" {
+		for _, m := range rest[1:] {
+			move := game.Move(m)
+			if !state.Check(move) {
+				return fmt.Errorf("illegal move %s", m)
+			}
+			state.Apply(move)
+		}
+	}
+
+	// a new root position means the old tree can't be reused.
+	if e.state.Positions()[0].String() != state.Positions()[0].String() {
+		e.newTree()
+	}
+	e.state = state
+	return nil
+}
+
+// newTree throws the search tree away and starts a fresh one.
+func (e *engine) newTree() {
+	agent := e.az.CurrentAgent
+	agent.MCTS.Reset()
+	agent.MCTS = mcts.New(e.state, agent.MCTS.Config, agent)
+}
+
+// parseGo turns the arguments of a go command into a search budget.
+func (e *engine) parseGo(args []string) mcts.Budget {
+	var b mcts.Budget
+	var wtime, btime, winc, binc, movetime time.Duration
+	for i := 0; i < len(args); i++ {
+		var val int
+		if i+1 < len(args) {
+			val, _ = strconv.Atoi(args[i+1])
+		}
+		ms := time.Duration(val) * time.Millisecond
+		switch args[i] {
+		case "nodes":
+			b.Nodes = val
+		case "movetime":
+			movetime = ms
+		case "wtime":
+			wtime = ms
+		case "btime":
+			btime = ms
+		case "winc":
+			winc = ms
+		case "binc":
+			binc = ms
+		default:
+			// infinite and unknown limits search until stop
+			continue
+		}
+		i++
+	}
+
+	remaining, inc := wtime, winc
+	if e.state.Turn() == chess.Black {
+		remaining, inc = btime, binc
+	}
+	if movetime == 0 && remaining > 0 {
+		movetime = remaining/movesToGo + inc/2
+		if movetime > remaining-timeMargin {
+			movetime = remaining - timeMargin
+		}
+	}
+	if movetime > timeMargin {
+		movetime -= timeMargin
+	}
+	b.Duration = movetime
+	return b
+}
+
+// search runs the search in the background until the budget is used up or stop is called,
+// then reports the best move.
+func (e *engine) search(b mcts.Budget) {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	state := e.state.Clone().(*game.Chess)
+	agent := e.az.CurrentAgent
+
+	e.wg.Add(1)
+	go func() {
+		defer e.wg.Done()
+		defer cancel()
+
+		// report progress while searching
+		done := make(chan struct{})
+		reported := make(chan struct{})
+		go func() {
+			defer close(reported)
+			ticker := time.NewTicker(infoInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					e.info(state)
+				case <-done:
+					return
+				}
+			}
+		}()
+
+		best, err := agent.SearchWithBudget(ctx, state, b)
+		close(done)
+		<-reported
+		if err != nil {
+			log.Printf("search error: %s", err)
+			best = "0000"
+		} else {
+			e.info(state)
+		}
+		e.send("bestmove %s", best)
+	}()
+}
+
+// info reports depth, nodes, score and principal variation of the search.
+func (e *engine) info(state *game.Chess) {
+	info := e.az.CurrentAgent.MCTS.SearchInfo()
+	var pv []string
+	st := state.Clone()
+	for _, idx := range info.PV {
+		m, err := st.NNToMove(idx)
+		if err != nil || !st.Check(m) {
+			break
+		}
+		pv = append(pv, string(m))
+		st = st.Apply(m)
+	}
+	e.send("info depth %d seldepth %d nodes %d score cp %d time %d nps %d pv %s",
+		len(pv), info.SelDepth, info.Nodes, centipawns(info.Value), info.Elapsed.Milliseconds(),
+		int64(info.NodesPerSecond), strings.Join(pv, " "))
+}
+
+// stopSearch stops a running search and waits for its bestmove to be sent.
+func (e *engine) stopSearch() {
+	if e.cancel != nil {
+		e.cancel()
+	}
+	e.wg.Wait()
+}
+
+// centipawns converts a value in [-1, 1] into a centipawn score.
+func centipawns(v float32) int {
+	q := math.Max(-0.99, math.Min(0.99, float64(v)))
+	return int(math.Round(290.680623072 * math.Tan(1.548090806*q)))
+}
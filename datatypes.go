@@ -2,6 +2,7 @@ package agogo
 
 import (
 	"io"
+	"time"
 
 	dual "github.com/alphabeth/dualnet"
 	"github.com/alphabeth/game"
@@ -18,9 +19,29 @@ type Config struct {
 	UpdateThreshold float64     `json:"update_threshold"`
 	// maximum number of examples
 	MaxExamples int `json:"max_examples"`
+	// Replay configures the window of self-play games the network is trained on.
+	// Without any limit only the games of the current iteration are used, as if MaxGenerations was 1.
+	Replay ReplayConfig `json:"replay"`
+	// SelfPlayWorkers, when larger than 1, is the number of self-play games played concurrently.
+	SelfPlayWorkers int `json:"self_play_workers"`
+	// CheckpointDir, if set, receives a numbered checkpoint after every training iteration.
+	CheckpointDir string `json:"checkpoint_dir"`
+	// KeepCheckpoints, when larger than 0, is the number of most recent checkpoints kept in CheckpointDir,
+	// older ones are deleted.
+	KeepCheckpoints int `json:"keep_checkpoints"`
+
+	// InferBatch, when larger than 1, makes the agent evaluate MCTS leaves in batches of up to this many positions,
+	// waiting at most InferBatchTimeout for a batch to fill up. InferBatchTimeout must then be positive, without
+	// any wait every batch would hold a single position.
+	InferBatch        int           `json:"infer_batch"`
+	InferBatchTimeout time.Duration `json:"infer_batch_timeout"`
+	// EvalCacheSize, when larger than 0, is the number of position evaluations the current agent caches.
+	EvalCacheSize int `json:"eval_cache_size"`
 
 	// extensions
 	Encoder GameEncoder
+	// EncoderInfo identifies Encoder in checkpoints, see game.Encoder.
+	EncoderInfo game.EncoderInfo `json:"encoder_info"`
 }
 
 // GameEncoder encodes a game state as a slice of floats
@@ -33,6 +54,12 @@ type Example struct {
 	Value  float32
 }
 
+// TrainMetrics are the training metrics of a batch or an epoch of a training iteration.
+type TrainMetrics struct {
+	Iteration int // training iteration, counting from 0
+	dual.Metrics
+}
+
 // Dualer is an interface for anything that allows getting out a *Dual.
 // Its sole purpose is to form a monoid-ish data structure for Agent.NN
 type Dualer interface {
@@ -45,6 +72,12 @@ type Inferer interface {
 	io.Closer
 }
 
+// BatchInferer is anything that can infer a batch of inputs in a single pass.
+type BatchInferer interface {
+	InferBatch(boards [][]float32) (policies [][]float32, values []float32, err error)
+	io.Closer
+}
+
 // ExecLogger is anything that can return the execution log.
 type ExecLogger interface {
 	ExecLog() string
@@ -0,0 +1,99 @@
+package dual
+
+import (
+	"reflect"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"gorgonia.org/tensor"
+)
+
+// batchNormFields are the fields of a gorgonia batch norm op holding its running statistics. gorgonia has no API
+// to read or set them, they are reached through reflection, which is why go.mod pins the gorgonia version they were
+// checked against. Without cuda init verifies them, so that a gorgonia update renaming or retyping them fails at
+// start up instead of silently saving networks without their statistics.
+var batchNormFields = []string{"mean", "variance", "ma"}
+
+// checkBatchNormOp checks that the batch norm op type t holds the running statistics in batchNormFields.
+func checkBatchNormOp(t reflect.Type) error {
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return errors.Errorf("unsupported batch norm op %v", t)
+	}
+	dense := reflect.TypeOf((*tensor.Dense)(nil))
+	for _, name := range batchNormFields {
+		f, ok := t.Elem().FieldByName(name)
+		if !ok {
+			return errors.Errorf("batch norm op %v has no field %s, the running statistics cannot be saved", t, name)
+		}
+		if f.Type != dense {
+			return errors.Errorf("field %s of batch norm op %v is %v, not %v", name, t, f.Type, dense)
+		}
+	}
+	return nil
+}
+
+// batchNormStats returns the running statistics of a batch norm op. They are not weights of the model, gorgonia
+// keeps them in unexported fields of the op, so they are reached through reflection. The returned slices share
+// the memory of the op.
+func batchNormStats(op batchNormOp) ([][]float32, error) {
+	if err := checkBatchNormOp(reflect.TypeOf(op)); err != nil {
+		return nil, err
+	}
+	v := reflect.ValueOf(op).Elem()
+
+	retVal := make([][]float32, 0, len(batchNormFields))
+	for _, name := range batchNormFields {
+		f := v.FieldByName(name)
+		f = reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+		t := f.Interface().(*tensor.Dense)
+		if t == nil {
+			return nil, errors.Errorf("field %s of batch norm op %T is not allocated", name, op)
+		}
+		data, ok := t.Data().([]float32)
+		if !ok {
+			return nil, errors.Errorf("field %s of batch norm op %T holds %T", name, op, t.Data())
+		}
+		retVal = append(retVal, data)
+	}
+	return retVal, nil
+}
+
+// batchNormState returns the running statistics of all batch norm ops of d, in the order of d.ops.
+func (d *Dual) batchNormState() ([][]float32, error) {
+	var retVal [][]float32
+	for _, op := range d.ops {
+		stats, err := batchNormStats(op)
+		if err != nil {
+			return nil, err
+		}
+		retVal = append(retVal, stats...)
+	}
+	return retVal, nil
+}
+
+// setBatchNormState copies state, as returned by batchNormState, into the batch norm ops of d.
+func (d *Dual) setBatchNormState(state [][]float32) error {
+	dst, err := d.batchNormState()
+	if err != nil {
+		return err
+	}
+	if len(dst) != len(state) {
+		return errors.Errorf("expected %d batch norm statistics, got %d", len(dst), len(state))
+	}
+	for i := range dst {
+		if len(dst[i]) != len(state[i]) {
+			return errors.Errorf("batch norm statistic %d has size %d, expected %d", i, len(state[i]), len(dst[i]))
+		}
+		copy(dst[i], state[i])
+	}
+	return nil
+}
+
+// copyBatchNormState copies the running statistics of the batch norm ops of src into dst.
+func copyBatchNormState(dst, src *Dual) error {
+	state, err := src.batchNormState()
+	if err != nil {
+		return err
+	}
+	return dst.setBatchNormState(state)
+}
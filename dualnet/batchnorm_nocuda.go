@@ -0,0 +1,15 @@
+// +build !cuda
+
+package dual
+
+import (
+	"reflect"
+
+	"gorgonia.org/gorgonia/ops/nn"
+)
+
+func init() {
+	if err := checkBatchNormOp(reflect.TypeOf(nnops.BatchNorm).Out(3)); err != nil {
+		panic(err)
+	}
+}
@@ -11,6 +11,15 @@ type Config struct {
 	Features     int  `json:"features"`      // feature counts
 	ActionSpace  int  `json:"action_space"`  // action space
 	FwdOnly      bool `json:"fwd_only"`      // is this a fwd only graph?
+
+	// InferBatchSize is the batch dimension of inference graphs built by Infer, BatchSize if 0.
+	InferBatchSize int `json:"infer_batch_size"`
+
+	// weights of the policy and value losses in the training cost, zero means 1
+	PolicyWeight float64 `json:"policy_weight"`
+	ValueWeight  float64 `json:"value_weight"`
+
+	Train TrainConfig `json:"train"` // optimisation of the network
 }
 
 // DefaultConf returns default config for neural network.
@@ -25,6 +34,9 @@ func DefaultConf(m, n, actionSpace int) Config {
 		Height:       m,
 		Features:     18,
 		ActionSpace:  actionSpace,
+		PolicyWeight: 1,
+		ValueWeight:  1,
+		Train:        DefaultTrainConfig(),
 	}
 }
 
@@ -36,6 +48,10 @@ func (conf Config) IsValid() bool {
 		conf.SharedLayers >= 0 &&
 		conf.FC > 1 &&
 		conf.BatchSize >= 1 &&
+		conf.InferBatchSize >= 0 &&
+		conf.PolicyWeight >= 0 &&
+		conf.ValueWeight >= 0 &&
+		conf.Train.IsValid() &&
 		// conf.ActionSpace >= conf.Width*conf.Height &&
 		conf.Features > 0
 }
@@ -3,6 +3,8 @@ package dual
 import (
 	"bytes"
 	"encoding/gob"
+	"io"
+	"sync"
 
 	G "gorgonia.org/gorgonia"
 	"gorgonia.org/tensor"
@@ -30,6 +32,18 @@ type Dual struct {
 	policyValue G.Value // policy predicted
 	value       G.Value // the actual value predicted
 	cost        G.Value // cost, for training recoring
+	policyCost  G.Value // unweighted policy loss
+	valueCost   G.Value // unweighted value loss
+
+	opt *optimizer // training state, created on the first call to Train
+
+	// weights holding one row per element of the batch (batch norm scales and biases, linear biases)
+	batchParams map[*G.Node]struct{}
+
+	// shared inference weights by batch size, see InferenceWeights
+	weightsLock sync.Mutex
+	weights     map[int]*Weights
+	version     uint64
 }
 
 // New returns a new, uninitialized *Dual.
@@ -103,6 +117,11 @@ func (d *Dual) fwd(actionSpace int) (logits, valueOutput *G.Node) {
 	// add ops
 	d.ops = append(d.ops, pop, vop)
 
+	d.batchParams = make(map[*G.Node]struct{}, len(m.batchParams))
+	for _, n := range m.batchParams {
+		d.batchParams[n] = struct{}{}
+	}
+
 	return logits, valueOutput
 }
 
@@ -116,16 +135,21 @@ func (d *Dual) bwd(actionSpace int, logits, valueOutput *G.Node) error {
 	var m maebe
 	// policy, value and combined costs
 	var pcost, vcost, ccost *G.Node
-	pcost = m.xent(logits, d.Π) // cross entropy, averaged.
+	pcost = m.policyXent(logits, d.Π) // categorical cross entropy, averaged over the batch.
 	vcost = m.do(func() (*G.Node, error) { return G.Sub(valueOutput, d.V) })
 	vcost = m.do(func() (*G.Node, error) { return G.Square(vcost) })
 	vcost = m.do(func() (*G.Node, error) { return G.Mean(vcost) })
 
 	// combined costs
-	ccost = m.do(func() (*G.Node, error) { return G.Add(pcost, vcost) })
+	pweight, vweight := d.lossWeights()
+	wpcost := m.scale(pcost, pweight)
+	wvcost := m.scale(vcost, vweight)
+	ccost = m.do(func() (*G.Node, error) { return G.Add(wpcost, wvcost) })
 	if m.err != nil {
 		return m.err
 	}
+	G.Read(pcost, &d.policyCost)
+	G.Read(vcost, &d.valueCost)
 	G.Read(ccost, &d.cost)
 
 	if _, err := G.Grad(ccost, d.Model()...); err != nil {
@@ -135,6 +159,18 @@ func (d *Dual) bwd(actionSpace int, logits, valueOutput *G.Node) error {
 	return nil
 }
 
+// lossWeights returns the weights of the policy and value losses, a zero weight in the config counts as 1.
+func (d *Dual) lossWeights() (policy, value float64) {
+	policy, value = d.PolicyWeight, d.ValueWeight
+	if policy == 0 {
+		policy = 1
+	}
+	if value == 0 {
+		value = 1
+	}
+	return
+}
+
 // Model returns model weights.
 func (d *Dual) Model() G.Nodes {
 	retVal := make(G.Nodes, 0, d.g.Nodes().Len())
@@ -163,14 +199,37 @@ func (d *Dual) Clone() (*Dual, error) {
 	model := d.Model()
 	model2 := d2.Model()
 	for i, n := range model {
-		if err := G.Let(model2[i], n.Value()); err != nil {
+		// the values are copied so that training the clone leaves the weights of d untouched
+		v, err := G.CloneValue(n.Value())
+		if err != nil {
+			return nil, err
+		}
+		if err := G.Let(model2[i], v); err != nil {
 			return nil, err
 		}
 	}
 
+	if err := copyBatchNormState(d2, d); err != nil {
+		return nil, err
+	}
+	d2.SetTrainSteps(d.TrainSteps())
 	return d2, nil
 }
 
+// TrainSteps returns the number of optimisation steps the network has been trained for.
+func (d *Dual) TrainSteps() int {
+	if d.opt == nil {
+		return 0
+	}
+	return d.opt.steps
+}
+
+// SetTrainSteps sets the number of optimisation steps the learn rate schedule continues from, for instance when
+// training is resumed from a checkpoint. The state of the solver is reset.
+func (d *Dual) SetTrainSteps(steps int) {
+	d.opt = newOptimizer(d.Train, steps)
+}
+
 // Dual implemented Dualer
 func (d *Dual) Dual() *Dual { return d }
 
@@ -184,7 +243,8 @@ func (d *Dual) reset() {
 	d.policyOutput = nil
 }
 
-// GobEncode encodes neural network in bytes.
+// GobEncode encodes neural network in bytes. The weights are followed by the running statistics of the batch norm
+// ops, which are needed to infer with a trained network.
 func (d *Dual) GobEncode() (retVal []byte, err error) {
 	var buf bytes.Buffer
 	enc := gob.NewEncoder(&buf)
@@ -194,11 +254,19 @@ func (d *Dual) GobEncode() (retVal []byte, err error) {
 			return nil, err
 		}
 	}
+	state, err := d.batchNormState()
+	if err != nil {
+		return nil, err
+	}
+	if err = enc.Encode(state); err != nil {
+		return nil, err
+	}
 	return buf.Bytes(), nil
 }
 
-// GobDecode decodes bytes to neural network.
+// GobDecode decodes bytes to neural network. Networks encoded without batch norm statistics keep the default ones.
 func (d *Dual) GobDecode(p []byte) error {
+	defer d.weightsChanged()
 	d.reset()
 	d.Init()
 
@@ -211,5 +279,14 @@ func (d *Dual) GobDecode(p []byte) error {
 		}
 		G.Let(n, v)
 	}
-	return nil
+
+	var state [][]float32
+	switch err := dec.Decode(&state); err {
+	case nil:
+		return d.setBatchNormState(state)
+	case io.EOF:
+		return nil
+	default:
+		return err
+	}
 }
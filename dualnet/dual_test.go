@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/gob"
 	"fmt"
+	"math"
 	"os"
+	"reflect"
 	"runtime"
 	"testing"
 	"time"
@@ -182,3 +184,300 @@ func TestShuffleBatch(t *testing.T) {
 		t.Logf("Xs:\n%v\nPis:\n%v\nVs:\n%v", Xs, pis, vs)
 	}
 }
+
+func TestPolicyXentGrad(t *testing.T) {
+	assert := assert.New(t)
+	const batch, actions = 3, 5
+	const eps = 1e-2
+
+	g := G.NewGraph()
+	logits := G.NewMatrix(g, Float, G.WithShape(batch, actions), G.WithName("logits"), G.WithInit(G.Gaussian(0, 2)))
+	target := G.NewMatrix(g, Float, G.WithShape(batch, actions), G.WithName("target"))
+	var m maebe
+	cost := m.policyXent(logits, target)
+	if m.err != nil {
+		t.Fatalf("%+v", m.err)
+	}
+	grads, err := G.Grad(cost, logits)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	var costVal, gradVal G.Value
+	G.Read(cost, &costVal)
+	G.Read(grads[0], &gradVal)
+
+	// every row of the target is a probability distribution, like the MCTS visit distribution
+	π := tensor.Random(Float, batch*actions).([]float32)
+	for row := 0; row < batch; row++ {
+		var sum float32
+		for _, p := range π[row*actions : (row+1)*actions] {
+			sum += p
+		}
+		for i := row * actions; i < (row+1)*actions; i++ {
+			π[i] /= sum
+		}
+	}
+	G.Let(target, tensor.New(tensor.WithShape(batch, actions), tensor.WithBacking(π)))
+
+	machine := G.NewTapeMachine(g)
+	defer machine.Close()
+	run := func() float32 {
+		machine.Reset()
+		if err := machine.RunAll(); err != nil {
+			t.Fatalf("%+v", err)
+		}
+		return costVal.Data().(float32)
+	}
+
+	run()
+	analytic := append([]float32(nil), gradVal.Data().([]float32)...)
+	data := logits.Value().Data().([]float32)
+	for i := range data {
+		orig := data[i]
+		data[i] = orig + eps
+		plus := run()
+		data[i] = orig - eps
+		minus := run()
+		data[i] = orig
+
+		numeric := (plus - minus) / (2 * eps)
+		assert.InDelta(numeric, analytic[i], 1e-3, "gradient of logit %d", i)
+	}
+}
+
+func TestTrainWithMetrics(t *testing.T) {
+	assert := assert.New(t)
+	boardSize := 3
+	conf := DefaultConf(boardSize, boardSize, boardSize*boardSize+1)
+	conf.BatchSize = 4
+	d := &Dual{Config: conf}
+	if err := d.Init(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	const batches, epochs = 2, 3
+	n := batches * conf.BatchSize
+	Xs := tensor.New(tensor.WithShape(n, conf.Features, boardSize, boardSize), tensor.WithBacking(tensor.Random(Float, n*conf.Features*boardSize*boardSize)))
+	π := tensor.New(tensor.WithShape(n, conf.ActionSpace), tensor.WithBacking(tensor.Random(Float, n*conf.ActionSpace)))
+	v := tensor.New(tensor.WithShape(n), tensor.WithBacking(tensor.Random(Float, n)))
+
+	var batchMetrics, epochMetrics []Metrics
+	err := TrainWithMetrics(d, Xs, π, v, batches, epochs, func(m Metrics) {
+		if m.EpochEnd {
+			epochMetrics = append(epochMetrics, m)
+			return
+		}
+		batchMetrics = append(batchMetrics, m)
+	})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assert.Len(batchMetrics, batches*epochs)
+	assert.Len(epochMetrics, epochs)
+	for _, m := range append(batchMetrics, epochMetrics...) {
+		assert.False(math.IsNaN(m.Loss) || math.IsInf(m.Loss, 0), "loss of %+v", m)
+		assert.InDelta(m.PolicyLoss+m.ValueLoss, m.Loss, 1e-4, "loss of %+v", m)
+		assert.True(m.PolicyEntropy > 0 && m.PolicyEntropy <= math.Log(float64(conf.ActionSpace))+1e-6, "entropy of %+v", m)
+		assert.Equal(0.1, m.LearnRate)
+	}
+	assert.Equal(batches*epochs, d.TrainSteps())
+}
+
+func TestEncodeDecodeBatchNormState(t *testing.T) {
+	assert := assert.New(t)
+	boardSize := 3
+	conf := DefaultConf(boardSize, boardSize, boardSize*boardSize+1)
+	conf.BatchSize = 4
+	d := &Dual{Config: conf}
+	if err := d.Init(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	// training moves the running statistics of the batch norm ops away from their defaults
+	n := 2 * conf.BatchSize
+	Xs := tensor.New(tensor.WithShape(n, conf.Features, boardSize, boardSize), tensor.WithBacking(G.Uniform(1, 3)(Float, n, conf.Features, boardSize, boardSize)))
+	π := tensor.New(tensor.WithShape(n, conf.ActionSpace), tensor.WithBacking(tensor.Random(Float, n*conf.ActionSpace)))
+	v := tensor.New(tensor.WithShape(n), tensor.WithBacking(tensor.Random(Float, n)))
+	if err := Train(d, Xs, π, v, 2, 2); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(d); err != nil {
+		t.Fatalf("Encoding Failure %v", err)
+	}
+	d2 := &Dual{Config: conf}
+	if err := gob.NewDecoder(&buf).Decode(d2); err != nil {
+		t.Fatalf("Decoding Failure %v", err)
+	}
+	d3, err := d.Clone()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	state, err := d.batchNormState()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	for _, other := range []*Dual{d2, d3} {
+		otherState, err := other.batchNormState()
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		assert.Equal(state, otherState)
+	}
+
+	board := tensor.Random(Float, conf.Features*boardSize*boardSize).([]float32)
+	infer := func(d *Dual) ([]float32, float32) {
+		inferer, err := Infer(d, false)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		defer inferer.Close()
+		policy, value, err := inferer.Infer(board)
+		if err != nil {
+			t.Fatalf("%+v", err)
+		}
+		return append([]float32(nil), policy...), value
+	}
+	policy, value := infer(d)
+	for i, other := range []*Dual{d2, d3} {
+		policy2, value2 := infer(other)
+		assert.Equal(policy, policy2, "policy of copy %d", i)
+		assert.Equal(value, value2, "value of copy %d", i)
+	}
+}
+
+func TestInferBatched(t *testing.T) {
+	assert := assert.New(t)
+	boardSize := 3
+	conf := DefaultConf(boardSize, boardSize, boardSize*boardSize+1)
+	conf.BatchSize = 32
+	d := &Dual{Config: conf}
+	if err := d.Init(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	single, err := InferBatched(d, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer single.Close()
+	batched, err := InferBatched(d, 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer batched.Close()
+	assert.Equal(1, single.input.Shape()[0])
+	assert.Equal(4, batched.input.Shape()[0])
+
+	boards := make([][]float32, 4)
+	for i := range boards {
+		boards[i] = tensor.Random(Float, conf.Features*boardSize*boardSize).([]float32)
+	}
+	policies, values, err := batched.InferBatch(boards)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, board := range boards {
+		policy, value, err := single.Infer(board)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.InDeltaSlice(policies[i], policy, 1e-5, "policy of board %d", i)
+		assert.InDelta(values[i], value, 1e-5, "value of board %d", i)
+	}
+
+	// the inference graph limits the batch, not the training batch size
+	if _, _, err := batched.InferBatch(make([][]float32, 5)); err == nil {
+		t.Error("Expected an error when inferring more boards than the inference batch")
+	}
+	policies, values, err = batched.InferBatch(boards[:2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(policies, 2)
+	assert.Len(values, 2)
+
+	if _, err := InferBatched(d, 0, false); err == nil {
+		t.Error("Expected an error for an empty inference batch")
+	}
+}
+
+func TestInferenceWeights(t *testing.T) {
+	assert := assert.New(t)
+	boardSize := 3
+	conf := DefaultConf(boardSize, boardSize, boardSize*boardSize+1)
+	conf.BatchSize = 4
+	d := &Dual{Config: conf}
+	if err := d.Init(); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	w, err := d.InferenceWeights(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, err := d.InferenceWeights(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(w == w2, "weights should be reused while the network is unchanged")
+
+	inf1, err := w.Inferencer(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf1.Close()
+	inf2, err := w.Inferencer(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inf2.Close()
+	for i, n := range inf1.d.Model() {
+		assert.True(n.Value() == inf2.d.Model()[i].Value(), "weight %v should be shared", n)
+	}
+
+	board := tensor.Random(Float, conf.Features*boardSize*boardSize).([]float32)
+	policy1, value1, err := inf1.Infer(board)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy1 = append([]float32(nil), policy1...)
+	policy2, value2, err := inf2.Infer(board)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(policy1, policy2)
+	assert.Equal(value1, value2)
+
+	version := d.Version()
+	n := conf.BatchSize
+	Xs := tensor.New(tensor.WithShape(n, conf.Features, boardSize, boardSize), tensor.WithBacking(tensor.Random(Float, n*conf.Features*boardSize*boardSize)))
+	π := tensor.New(tensor.WithShape(n, conf.ActionSpace), tensor.WithBacking(tensor.Random(Float, n*conf.ActionSpace)))
+	v := tensor.New(tensor.WithShape(n), tensor.WithBacking(tensor.Random(Float, n)))
+	if err := Train(d, Xs, π, v, 1, 1); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assert.NotEqual(version, d.Version())
+	w3, err := d.InferenceWeights(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(w == w3, "weights should be refreshed after training")
+}
+
+func TestCheckBatchNormOp(t *testing.T) {
+	assert := assert.New(t)
+	assert.NoError(checkBatchNormOp(reflect.TypeOf(&G.BatchNormOp{})))
+
+	type renamed struct {
+		mean, variance, movingAverage *tensor.Dense
+	}
+	assert.Error(checkBatchNormOp(reflect.TypeOf(&renamed{})))
+	type retyped struct {
+		mean, variance, ma []float32
+	}
+	assert.Error(checkBatchNormOp(reflect.TypeOf(&retyped{})))
+	assert.Error(checkBatchNormOp(reflect.TypeOf(G.BatchNormOp{})))
+}
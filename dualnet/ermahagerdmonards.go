@@ -11,6 +11,9 @@ import (
 
 type maebe struct {
 	err error
+
+	// batchParams are the weights created with one row per element of the batch
+	batchParams []*G.Node
 }
 
 type batchNormOp interface {
@@ -51,9 +54,13 @@ func (m *maebe) batchnorm(input *G.Node) (retVal *G.Node, retOp batchNormOp) {
 	}
 	// note: the scale and biases will still be created
 	// and they will still be backpropagated
-	if retVal, _, _, retOp, m.err = nnops.BatchNorm(input, nil, nil, 0.997, 1e-5); m.err != nil {
+	var scale, bias *G.Node
+	if retVal, scale, bias, retOp, m.err = nnops.BatchNorm(input, nil, nil, 0.997, 1e-5); m.err != nil {
 		m.err = errors.WithStack(m.err)
+		return
 	}
+	// the scale and bias have the shape of the input, batch included
+	m.batchParams = append(m.batchParams, scale, bias)
 	return
 }
 
@@ -80,6 +87,7 @@ func (m *maebe) linear(input *G.Node, units int, name string) *G.Node {
 	w := G.NewTensor(input.Graph(), Float, 2, G.WithShape(input.Shape()[1], units), G.WithInit(G.GlorotN(1.0)), G.WithName(name+"_w"))
 	xw := m.do(func() (*G.Node, error) { return G.Mul(input, w) })
 	b := G.NewTensor(xw.Graph(), Float, xw.Shape().Dims(), G.WithShape(xw.Shape().Clone()...), G.WithName(name+"_b"), G.WithInit(G.Zeroes()))
+	m.batchParams = append(m.batchParams, b)
 	return m.do(func() (*G.Node, error) { return G.Add(xw, b) })
 }
 
@@ -103,49 +111,88 @@ func (m *maebe) reshape(input *G.Node, to tensor.Shape) (retVal *G.Node) {
 	return
 }
 
-func (m *maebe) xent(output, target *G.Node) (retVal *G.Node) {
-	var one *G.Node
+// policyXent is the categorical cross-entropy -π·log p between the target distributions and the softmax of the
+// logits, summed over the actions and averaged over the batch. The log-softmax is computed directly from the
+// logits, so that it stays finite for very confident predictions.
+func (m *maebe) policyXent(logits, target *G.Node) (retVal *G.Node) {
+	if m.err != nil {
+		return nil
+	}
+	var batch *G.Node
 	switch Float {
 	case G.Float32:
-		one = G.NewConstant(float32(1))
+		batch = G.NewConstant(float32(logits.Shape()[0]))
 	case G.Float64:
-		one = G.NewConstant(float64(1))
+		batch = G.NewConstant(float64(logits.Shape()[0]))
 	}
-	var omy, omout *G.Node
-	if omy, m.err = G.Sub(one, target); m.err != nil {
+
+	var logp, prod *G.Node
+	if logp = m.logSoftMax(logits); m.err != nil {
+		return nil
+	}
+	if prod, m.err = G.HadamardProd(target, logp); m.err != nil {
 		m.err = errors.WithStack(m.err)
 		return nil
 	}
-
-	if omout, m.err = G.Sub(one, output); m.err != nil {
+	if retVal, m.err = G.Sum(prod); m.err != nil {
 		m.err = errors.WithStack(m.err)
 		return nil
 	}
+	if retVal, m.err = G.Div(retVal, batch); m.err != nil {
+		m.err = errors.WithStack(m.err)
+		return nil
+	}
+	if retVal, m.err = G.Neg(retVal); m.err != nil {
+		m.err = errors.WithStack(m.err)
+	}
+	return
+}
 
-	var fst, snd *G.Node
-	if fst, m.err = G.HadamardProd(target, output); m.err != nil {
+// logSoftMax computes the log-softmax of every row of the logits as logits - max - log(Σ exp(logits - max)).
+// Subtracting the row maximum keeps the exponentials from overflowing.
+func (m *maebe) logSoftMax(logits *G.Node) (retVal *G.Node) {
+	if m.err != nil {
+		return nil
+	}
+	var max, shifted, exp, sum, logSum *G.Node
+	if max, m.err = G.Max(logits, 1); m.err != nil {
 		m.err = errors.WithStack(m.err)
 		return nil
 	}
-	if snd, m.err = G.HadamardProd(omy, omout); m.err != nil {
+	if shifted, m.err = G.BroadcastSub(logits, max, nil, []byte{1}); m.err != nil {
 		m.err = errors.WithStack(m.err)
 		return nil
 	}
-
-	if retVal, m.err = G.Add(fst, snd); m.err != nil {
+	if exp, m.err = G.Exp(shifted); m.err != nil {
 		m.err = errors.WithStack(m.err)
 		return nil
 	}
-	if retVal, m.err = G.Neg(retVal); m.err != nil {
+	if sum, m.err = G.Sum(exp, 1); m.err != nil {
 		m.err = errors.WithStack(m.err)
 		return nil
 	}
-	if retVal, m.err = G.Mean(retVal); m.err != nil {
+	if logSum, m.err = G.Log(sum); m.err != nil {
+		m.err = errors.WithStack(m.err)
+		return nil
+	}
+	if retVal, m.err = G.BroadcastSub(shifted, logSum, nil, []byte{1}); m.err != nil {
 		m.err = errors.WithStack(m.err)
 	}
 	return
 }
 
+// scale multiplies input by the constant w.
+func (m *maebe) scale(input *G.Node, w float64) *G.Node {
+	var c *G.Node
+	switch Float {
+	case G.Float32:
+		c = G.NewConstant(float32(w))
+	case G.Float64:
+		c = G.NewConstant(w)
+	}
+	return m.do(func() (*G.Node, error) { return G.Mul(input, c) })
+}
+
 func findPadding(inputX, inputY, kernelX, kernelY int) []int {
 	return []int{
 		(inputX - 1 - inputX + kernelX) / 2,
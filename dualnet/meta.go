@@ -12,15 +12,25 @@ import (
 	"gorgonia.org/tensor/native"
 )
 
-// Train is a basic trainer.
+// Train trains d for iterations epochs with the solver, learn rate schedule and regularisation of its TrainConfig.
+// The schedule continues from the steps of previous calls.
 func Train(d *Dual, Xs, policies, values *tensor.Dense, batches, iterations int) error {
+	return TrainWithMetrics(d, Xs, policies, values, batches, iterations, nil)
+}
+
+// TrainWithMetrics is Train reporting the metrics of every batch and epoch to report, if it is not nil.
+func TrainWithMetrics(d *Dual, Xs, policies, values *tensor.Dense, batches, iterations int, report MetricsFunc) error {
 	m := G.NewTapeMachine(d.g, G.BindDualValues(d.Model()...))
 	defer m.Close()
 	model := G.NodesToValueGrads(d.Model())
-	solver := G.NewVanillaSolver(G.WithLearnRate(0.1))
+	if d.opt == nil {
+		d.SetTrainSteps(0)
+	}
+	solver := d.opt
+	defer d.weightsChanged()
 	var s slicer
 	for i := 0; i < iterations; i++ {
-		// var cost float32
+		epoch := Metrics{Epoch: i, Batch: -1, EpochEnd: true}
 		for bat := 0; bat < batches; bat++ {
 			batchStart := bat * d.Config.BatchSize
 			batchEnd := batchStart + d.Config.BatchSize
@@ -35,10 +45,24 @@ func Train(d *Dual, Xs, policies, values *tensor.Dense, batches, iterations int)
 			if err := m.RunAll(); err != nil {
 				return err
 			}
-			// cost = d.cost.Data().(float32)
-			if err := solver.Step(model); err != nil {
+			lr, gradNorm, err := solver.Step(model)
+			if err != nil {
 				return err
 			}
+			if report != nil {
+				metrics := Metrics{
+					Epoch:         i,
+					Batch:         bat,
+					Loss:          scalar(d.cost),
+					PolicyLoss:    scalar(d.policyCost),
+					ValueLoss:     scalar(d.valueCost),
+					PolicyEntropy: policyEntropy(d.policyValue.Data().([]float32), d.ActionSpace),
+					LearnRate:     lr,
+					GradNorm:      gradNorm,
+				}
+				epoch.add(metrics)
+				report(metrics)
+			}
 			m.Reset()
 			tensor.ReturnTensor(Xs2)
 			tensor.ReturnTensor(π)
@@ -47,8 +71,10 @@ func Train(d *Dual, Xs, policies, values *tensor.Dense, batches, iterations int)
 		if err := shuffleBatch(Xs, policies, values); err != nil {
 			return err
 		}
-		// TODO: add a channel to send training  cost data down
-		// log.Printf("%d\t%v", i, cost/float32(batches))
+		if report != nil && batches > 0 {
+			epoch.scale(batches)
+			report(epoch)
+		}
 	}
 	return nil
 }
@@ -121,41 +147,47 @@ type Inferencer struct {
 	buf   *bytes.Buffer
 }
 
-// Infer takes a trained *Dual, and creates a inference data structure such that it'd be easy to infer
+// Infer takes a trained *Dual, and creates a inference data structure such that it'd be easy to infer.
+// The batch dimension of the inference graph is InferBatchSize, or BatchSize if that is not set.
 func Infer(d *Dual, toLog bool) (*Inferencer, error) {
-	conf := d.Config
-	conf.FwdOnly = true
-	retVal := &Inferencer{
-		d:     New(conf),
-		input: tensor.New(tensor.WithShape(d.planes.Shape()...), tensor.Of(Float)),
+	batch := d.InferBatchSize
+	if batch <= 0 {
+		batch = d.BatchSize
 	}
-	if err := retVal.d.Init(); err != nil {
+	return InferBatched(d, batch, toLog)
+}
+
+// InferBatched is Infer with an inference graph of batch rows, so that evaluating single positions does not pay
+// for the rows of a training batch. The inferencer owns its copy of the weights, see InferenceWeights for
+// inferencers sharing them.
+func InferBatched(d *Dual, batch int, toLog bool) (*Inferencer, error) {
+	w, err := NewWeights(d, batch)
+	if err != nil {
 		return nil, err
 	}
-	retVal.d.SetTesting()
-	// G.WithInit(G.Zeroes())(retVal.d.planes)
+	return w.Inferencer(toLog)
+}
+
+// batchParam reports whether a weight of d was created with the batch as its first dimension (batch norm scales
+// and biases, linear biases). Those hold different weights for each row of a batch.
+func (d *Dual) batchParam(n *G.Node) bool {
+	_, ok := d.batchParams[n]
+	return ok
+}
 
-	infModel := retVal.d.Model()
-	for i, n := range d.Model() {
-		original := n.Value().Data().([]float32)
-		cloned := infModel[i].Value().Data().([]float32)
+// copyWeights copies the weights of src into dst. Batch dependent weights get the first row of src copied
+// into every row of dst, so each row of an inference batch is evaluated like the first one.
+func copyWeights(dst, src *G.Node, batchDependent bool) {
+	original := src.Value().Data().([]float32)
+	cloned := dst.Value().Data().([]float32)
+	if !batchDependent {
 		copy(cloned, original)
+		return
 	}
-
-	retVal.buf = new(bytes.Buffer)
-	if toLog {
-		logger := log.New(retVal.buf, "", 0)
-		retVal.m = G.NewTapeMachine(retVal.d.g,
-			G.WithLogger(logger),
-			G.WithWatchlist(),
-			G.TraceExec(),
-			G.WithValueFmt("%+1.1v"),
-			G.WithNaNWatch(),
-		)
-	} else {
-		retVal.m = G.NewTapeMachine(retVal.d.g)
+	rowSize := len(original) / src.Shape()[0]
+	for start := 0; start < len(cloned); start += rowSize {
+		copy(cloned[start:start+rowSize], original[:rowSize])
 	}
-	return retVal, nil
 }
 
 // Dual implements Dualer
@@ -163,10 +195,9 @@ func (m *Inferencer) Dual() *Dual { return m.d }
 
 // Infer takes the board, in form of a []float32, and runs inference, and returns the value
 func (m *Inferencer) Infer(board []float32) (policy []float32, value float32, err error) {
+	// the batch norm ops are not reset, in testing mode they normalise with the running statistics of the
+	// trained network
 	m.buf.Reset()
-	for _, op := range m.d.ops {
-		op.Reset()
-	}
 
 	// copy board to the provided preallocated input tensor
 	m.input.Zero()
@@ -184,6 +215,42 @@ func (m *Inferencer) Infer(board []float32) (policy []float32, value float32, er
 	return policy[:m.d.ActionSpace], value, nil
 }
 
+// InferBatch runs inference on a batch of boards in a single forward pass and returns one policy and one value
+// per board. At most as many boards as the batch dimension of the inference graph can be given.
+func (m *Inferencer) InferBatch(boards [][]float32) (policies [][]float32, values []float32, err error) {
+	batch := m.input.Shape()[0]
+	if len(boards) > batch {
+		return nil, nil, errors.Errorf("cannot infer %d boards with batch size %d", len(boards), batch)
+	}
+	m.buf.Reset()
+
+	// copy boards to the provided preallocated input tensor, one row each
+	m.input.Zero()
+	data := m.input.Data().([]float32)
+	rowSize := len(data) / batch
+	for i, board := range boards {
+		copy(data[i*rowSize:(i+1)*rowSize], board)
+	}
+
+	m.m.Reset()
+	G.Let(m.d.planes, m.input)
+	if err = m.m.RunAll(); err != nil {
+		return nil, nil, err
+	}
+
+	// the output values are reused by the next run, so they are copied out
+	policy := m.d.policyValue.Data().([]float32)
+	value := m.d.value.Data().([]float32)
+	policies = make([][]float32, len(boards))
+	values = make([]float32, len(boards))
+	for i := range boards {
+		policies[i] = make([]float32, m.d.ActionSpace)
+		copy(policies[i], policy[i*m.d.ActionSpace:(i+1)*m.d.ActionSpace])
+		values[i] = value[i]
+	}
+	return policies, values, nil
+}
+
 // ExecLog returns the execution log. If Infer was called with toLog = false, then it will return an empty string
 func (m *Inferencer) ExecLog() string { return m.buf.String() }
 
@@ -0,0 +1,70 @@
+package dual
+
+import (
+	"math"
+
+	G "gorgonia.org/gorgonia"
+)
+
+// Metrics are the training statistics of one batch, or the averages over the batches of one epoch.
+type Metrics struct {
+	Epoch    int  // epoch of the call to Train, counting from 0
+	Batch    int  // batch in the epoch, -1 for the summary of the epoch
+	EpochEnd bool // true for the summary of the epoch
+
+	Loss          float64 // weighted sum of the policy and value losses
+	PolicyLoss    float64 // cross entropy between the target and the predicted policies
+	ValueLoss     float64 // mean squared error of the predicted values
+	PolicyEntropy float64 // mean entropy of the predicted policies
+	LearnRate     float64
+	GradNorm      float64 // L2 norm of the gradients before clipping
+}
+
+// MetricsFunc receives the metrics of every batch and every epoch during training.
+type MetricsFunc func(Metrics)
+
+// add accumulates the losses and statistics of other into m.
+func (m *Metrics) add(other Metrics) {
+	m.Loss += other.Loss
+	m.PolicyLoss += other.PolicyLoss
+	m.ValueLoss += other.ValueLoss
+	m.PolicyEntropy += other.PolicyEntropy
+	m.LearnRate = other.LearnRate
+	m.GradNorm += other.GradNorm
+}
+
+// scale divides the accumulated sums of m by n, except for the learn rate which is the last one.
+func (m *Metrics) scale(n int) {
+	f := 1 / float64(n)
+	m.Loss *= f
+	m.PolicyLoss *= f
+	m.ValueLoss *= f
+	m.PolicyEntropy *= f
+	m.GradNorm *= f
+}
+
+// policyEntropy returns the mean entropy of the rows of the batch of policies.
+func policyEntropy(policies []float32, actionSpace int) float64 {
+	rows := len(policies) / actionSpace
+	if rows == 0 {
+		return 0
+	}
+	var h float64
+	for _, p := range policies[:rows*actionSpace] {
+		if p > 0 {
+			h -= float64(p) * math.Log(float64(p))
+		}
+	}
+	return h / float64(rows)
+}
+
+// scalar returns the value of a scalar node read during the run.
+func scalar(v G.Value) float64 {
+	switch x := v.Data().(type) {
+	case float32:
+		return float64(x)
+	case float64:
+		return x
+	}
+	return math.NaN()
+}
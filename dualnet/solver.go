@@ -0,0 +1,199 @@
+package dual
+
+import (
+	"math"
+
+	"github.com/pkg/errors"
+	G "gorgonia.org/gorgonia"
+)
+
+// Solver is the optimisation algorithm updating the weights during training.
+type Solver int
+
+// solvers.
+const (
+	VanillaSolver  Solver = iota // plain stochastic gradient descent
+	MomentumSolver               // stochastic gradient descent with momentum
+	AdamSolver
+	RMSPropSolver
+)
+
+// Schedule is the way the learn rate changes over the training steps.
+type Schedule int
+
+// learn rate schedules.
+const (
+	ConstantSchedule Schedule = iota
+	StepSchedule              // the learn rate is multiplied by StepGamma every StepSize steps
+	CosineSchedule            // the learn rate follows a cosine from LearnRate down to MinLearnRate over TotalSteps
+)
+
+// TrainConfig configures the optimisation of the network. Zero values of the solver parameters mean their default.
+type TrainConfig struct {
+	Solver    Solver  `json:"solver"`
+	LearnRate float64 `json:"learn_rate"` // initial learn rate, default 0.1
+	Momentum  float64 `json:"momentum"`   // momentum of MomentumSolver and decay of RMSPropSolver, default 0.9
+	Beta1     float64 `json:"beta1"`      // first moment decay of AdamSolver, default 0.9
+	Beta2     float64 `json:"beta2"`      // second moment decay of AdamSolver, default 0.999
+	Eps       float64 `json:"eps"`        // denominator smoothing of AdamSolver and RMSPropSolver, default 1e-8
+
+	Schedule     Schedule `json:"schedule"`
+	StepSize     int      `json:"step_size"`      // steps between two decays of StepSchedule
+	StepGamma    float64  `json:"step_gamma"`     // decay factor of StepSchedule
+	TotalSteps   int      `json:"total_steps"`    // length of the CosineSchedule
+	MinLearnRate float64  `json:"min_learn_rate"` // final learn rate of the CosineSchedule
+	WarmupSteps  int      `json:"warmup_steps"`   // steps of linear warm up before the schedule starts
+
+	WeightDecay float64 `json:"weight_decay"` // L2 regularisation factor
+	ClipNorm    float64 `json:"clip_norm"`    // maximum L2 norm of the gradient of all weights, none if 0
+}
+
+// DefaultTrainConfig returns the default training config, vanilla SGD with a constant learn rate.
+func DefaultTrainConfig() TrainConfig {
+	return TrainConfig{
+		Solver:    VanillaSolver,
+		LearnRate: 0.1,
+		Schedule:  ConstantSchedule,
+	}
+}
+
+// IsValid checks if the training config is valid or not.
+func (conf TrainConfig) IsValid() bool {
+	if conf.LearnRate < 0 || conf.Momentum < 0 || conf.Momentum >= 1 ||
+		conf.Beta1 < 0 || conf.Beta1 >= 1 || conf.Beta2 < 0 || conf.Beta2 >= 1 || conf.Eps < 0 ||
+		conf.WarmupSteps < 0 || conf.WeightDecay < 0 || conf.ClipNorm < 0 {
+		return false
+	}
+	switch conf.Solver {
+	case VanillaSolver, MomentumSolver, AdamSolver, RMSPropSolver:
+	default:
+		return false
+	}
+	switch conf.Schedule {
+	case ConstantSchedule:
+		return true
+	case StepSchedule:
+		return conf.StepSize > 0 && conf.StepGamma > 0
+	case CosineSchedule:
+		return conf.TotalSteps > 0 && conf.MinLearnRate >= 0
+	}
+	return false
+}
+
+// withDefaults fills in the defaults of the zero solver parameters.
+func (conf TrainConfig) withDefaults() TrainConfig {
+	if conf.LearnRate == 0 {
+		conf.LearnRate = 0.1
+	}
+	if conf.Momentum == 0 {
+		conf.Momentum = 0.9
+	}
+	if conf.Beta1 == 0 {
+		conf.Beta1 = 0.9
+	}
+	if conf.Beta2 == 0 {
+		conf.Beta2 = 0.999
+	}
+	if conf.Eps == 0 {
+		conf.Eps = 1e-8
+	}
+	return conf
+}
+
+// LearnRateAt returns the learn rate of the given training step, counting from 0.
+func (conf TrainConfig) LearnRateAt(step int) float64 {
+	conf = conf.withDefaults()
+	if step < conf.WarmupSteps {
+		return conf.LearnRate * float64(step+1) / float64(conf.WarmupSteps)
+	}
+	step -= conf.WarmupSteps
+
+	switch conf.Schedule {
+	case StepSchedule:
+		return conf.LearnRate * math.Pow(conf.StepGamma, float64(step/conf.StepSize))
+	case CosineSchedule:
+		if step >= conf.TotalSteps {
+			return conf.MinLearnRate
+		}
+		cos := 0.5 * (1 + math.Cos(math.Pi*float64(step)/float64(conf.TotalSteps)))
+		return conf.MinLearnRate + (conf.LearnRate-conf.MinLearnRate)*cos
+	}
+	return conf.LearnRate
+}
+
+// optimizer updates the weights of a network according to a TrainConfig with the gorgonia solver of its Solver.
+// Weight decay and gradient clipping are applied to the gradients before the solver runs: the clip option of the
+// gorgonia solvers clamps every gradient on its own instead of limiting the norm of all of them, and the L2 option
+// of their momentum solver decays the velocity instead of the weights.
+type optimizer struct {
+	conf   TrainConfig
+	steps  int // steps done so far
+	solver G.Solver
+}
+
+func newOptimizer(conf TrainConfig, steps int) *optimizer {
+	conf = conf.withDefaults()
+	lr := G.WithLearnRate(conf.LearnRateAt(steps))
+	var solver G.Solver
+	switch conf.Solver {
+	case MomentumSolver:
+		solver = G.NewMomentum(lr, G.WithMomentum(conf.Momentum))
+	case AdamSolver:
+		solver = G.NewAdamSolver(lr, G.WithBeta1(conf.Beta1), G.WithBeta2(conf.Beta2), G.WithEps(conf.Eps))
+	case RMSPropSolver:
+		solver = G.NewRMSPropSolver(lr, G.WithRho(conf.Momentum), G.WithEps(conf.Eps))
+	default:
+		solver = G.NewVanillaSolver(lr)
+	}
+	return &optimizer{
+		conf:   conf,
+		steps:  steps,
+		solver: solver,
+	}
+}
+
+// Step updates the weights of model with their gradients, which are zeroed afterwards.
+// It returns the learn rate used and the norm of the gradients before clipping.
+func (o *optimizer) Step(model []G.ValueGrad) (lr, gradNorm float64, err error) {
+	weights := make([][]float32, len(model))
+	grads := make([][]float32, len(model))
+	var sumSq float64
+	for i, n := range model {
+		grad, err := n.Grad()
+		if err != nil {
+			return 0, 0, errors.WithStack(err)
+		}
+		var ok bool
+		if weights[i], ok = n.Value().Data().([]float32); !ok {
+			return 0, 0, errors.Errorf("unsupported weight type %T", n.Value().Data())
+		}
+		if grads[i], ok = grad.Data().([]float32); !ok {
+			return 0, 0, errors.Errorf("unsupported gradient type %T", grad.Data())
+		}
+		for _, g := range grads[i] {
+			sumSq += float64(g) * float64(g)
+		}
+	}
+
+	gradNorm = math.Sqrt(sumSq)
+	scale := 1.0
+	if o.conf.ClipNorm > 0 && gradNorm > o.conf.ClipNorm {
+		scale = o.conf.ClipNorm / gradNorm
+	}
+	if scale != 1 || o.conf.WeightDecay > 0 {
+		for i, w := range weights {
+			for j, g := range grads[i] {
+				grads[i][j] = float32(float64(g)*scale + o.conf.WeightDecay*float64(w[j]))
+			}
+		}
+	}
+
+	// the learn rate of the solver follows the schedule
+	lr = o.conf.LearnRateAt(o.steps)
+	G.WithLearnRate(lr)(o.solver)
+	o.steps++
+	if err = o.solver.Step(model); err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+	return lr, gradNorm, nil
+}
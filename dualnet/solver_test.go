@@ -0,0 +1,51 @@
+package dual
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLearnRateAt(t *testing.T) {
+	conf := TrainConfig{
+		LearnRate:   0.2,
+		Schedule:    StepSchedule,
+		StepSize:    10,
+		StepGamma:   0.1,
+		WarmupSteps: 4,
+	}
+	if !conf.IsValid() {
+		t.Fatalf("Expected %+v to be valid", conf)
+	}
+	cases := []struct {
+		step int
+		lr   float64
+	}{
+		{0, 0.05},
+		{3, 0.2},
+		{4, 0.2},
+		{13, 0.2},
+		{14, 0.02},
+		{24, 0.002},
+	}
+	for _, c := range cases {
+		if lr := conf.LearnRateAt(c.step); math.Abs(lr-c.lr) > 1e-12 {
+			t.Errorf("Expected learn rate %v at step %d. Got %v instead", c.lr, c.step, lr)
+		}
+	}
+
+	conf = TrainConfig{
+		LearnRate:    1,
+		Schedule:     CosineSchedule,
+		TotalSteps:   10,
+		MinLearnRate: 0.1,
+	}
+	for step, want := range map[int]float64{0: 1, 5: 0.55, 10: 0.1, 20: 0.1} {
+		if lr := conf.LearnRateAt(step); math.Abs(lr-want) > 1e-12 {
+			t.Errorf("Expected cosine learn rate %v at step %d. Got %v instead", want, step, lr)
+		}
+	}
+
+	if (TrainConfig{Schedule: StepSchedule}).IsValid() {
+		t.Errorf("Expected a step schedule without step size to be invalid")
+	}
+}
@@ -0,0 +1,137 @@
+package dual
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/pkg/errors"
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// Weights is a read-only snapshot of the weights and batch norm statistics of a network, laid out for inference
+// graphs of one batch size. Inferencers created from the same Weights reference its tensors instead of copying
+// them, each of them only owns its graph and activations.
+type Weights struct {
+	conf    Config          // config of the inference graphs
+	values  []*tensor.Dense // one value per node of Model, in order
+	bnState [][]float32
+}
+
+// NewWeights takes a snapshot of the weights of d for inference graphs of batch rows. Later training of d does
+// not affect the snapshot.
+func NewWeights(d *Dual, batch int) (*Weights, error) {
+	if batch < 1 {
+		return nil, errors.Errorf("invalid inference batch size %d", batch)
+	}
+	conf := d.Config
+	conf.FwdOnly = true
+	conf.BatchSize = batch
+
+	// the weights are laid out by a template graph, whose values are kept once it is dropped
+	tmpl := New(conf)
+	if err := tmpl.Init(); err != nil {
+		return nil, err
+	}
+	tmplModel := tmpl.Model()
+	model := d.Model()
+	if len(tmplModel) != len(model) {
+		return nil, errors.Errorf("expected %d weights, got %d", len(tmplModel), len(model))
+	}
+	retVal := &Weights{
+		conf:   conf,
+		values: make([]*tensor.Dense, len(model)),
+	}
+	for i, n := range model {
+		copyWeights(tmplModel[i], n, d.batchParam(n))
+		v, ok := tmplModel[i].Value().(*tensor.Dense)
+		if !ok {
+			return nil, errors.Errorf("unsupported weight %v of type %T", tmplModel[i], tmplModel[i].Value())
+		}
+		retVal.values[i] = v
+	}
+
+	state, err := d.batchNormState()
+	if err != nil {
+		return nil, err
+	}
+	retVal.bnState = make([][]float32, len(state))
+	for i, s := range state {
+		retVal.bnState[i] = append([]float32(nil), s...)
+	}
+	return retVal, nil
+}
+
+// BatchSize returns the batch dimension of the inference graphs.
+func (w *Weights) BatchSize() int { return w.conf.BatchSize }
+
+// Inferencer creates an inference data structure referencing the weights.
+func (w *Weights) Inferencer(toLog bool) (*Inferencer, error) {
+	retVal := &Inferencer{
+		d: New(w.conf),
+	}
+	if err := retVal.d.Init(); err != nil {
+		return nil, err
+	}
+	retVal.input = tensor.New(tensor.WithShape(retVal.d.planes.Shape()...), tensor.Of(Float))
+	retVal.d.SetTesting()
+
+	// a forward only graph never writes to its weights, so they can be shared
+	for i, n := range retVal.d.Model() {
+		if err := G.Let(n, w.values[i]); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if err := retVal.d.setBatchNormState(w.bnState); err != nil {
+		return nil, err
+	}
+
+	retVal.buf = new(bytes.Buffer)
+	if toLog {
+		logger := log.New(retVal.buf, "", 0)
+		retVal.m = G.NewTapeMachine(retVal.d.g,
+			G.WithLogger(logger),
+			G.WithWatchlist(),
+			G.TraceExec(),
+			G.WithValueFmt("%+1.1v"),
+			G.WithNaNWatch(),
+		)
+	} else {
+		retVal.m = G.NewTapeMachine(retVal.d.g)
+	}
+	return retVal, nil
+}
+
+// InferenceWeights returns the shared inference weights of d for batch rows. The snapshot is taken on the first
+// call and reused until the weights of d change.
+func (d *Dual) InferenceWeights(batch int) (*Weights, error) {
+	d.weightsLock.Lock()
+	defer d.weightsLock.Unlock()
+	if w, ok := d.weights[batch]; ok {
+		return w, nil
+	}
+	w, err := NewWeights(d, batch)
+	if err != nil {
+		return nil, err
+	}
+	if d.weights == nil {
+		d.weights = make(map[int]*Weights)
+	}
+	d.weights[batch] = w
+	return w, nil
+}
+
+// Version returns a number that changes whenever the weights of d change, through training or decoding.
+func (d *Dual) Version() uint64 {
+	d.weightsLock.Lock()
+	defer d.weightsLock.Unlock()
+	return d.version
+}
+
+// weightsChanged drops the inference weights of d and moves it to a new version.
+func (d *Dual) weightsChanged() {
+	d.weightsLock.Lock()
+	d.weights = nil
+	d.version++
+	d.weightsLock.Unlock()
+}
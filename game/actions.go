@@ -0,0 +1,136 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/notnil/chess"
+)
+
+// AlphaZero action space constants. A move is encoded as a plane index times the number of squares
+// plus the from square, i.e. the policy output is laid out as [73][8][8].
+const (
+	QueenPlanes       = 56 // 8 directions * 7 distances
+	KnightPlanes      = 8  // 8 knight jumps
+	UnderPromoPlanes  = 9  // 3 pieces (knight, bishop, rook) * 3 file directions
+	MovePlanes        = QueenPlanes + KnightPlanes + UnderPromoPlanes
+	FullActionSpace   = MovePlanes * RowNum * ColNum
+	maxQueenDistance  = 7
+	knightPlaneOffset = QueenPlanes
+	promoPlaneOffset  = QueenPlanes + KnightPlanes
+)
+
+// queenDirections are (file, rank) steps, clockwise starting from north.
+var queenDirections = [8][2]int{
+	{0, 1}, {1, 1}, {1, 0}, {1, -1}, {0, -1}, {-1, -1}, {-1, 0}, {-1, 1},
+}
+
+// knightJumps are (file, rank) steps, clockwise starting from north-north-east.
+var knightJumps = [8][2]int{
+	{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2},
+}
+
+// underPromotions are the promotion suffixes that get their own planes. Queen promotions are encoded as
+// ordinary queen moves.
+var underPromotions = [3]string{"n", "b", "r"}
+
+// fullActionSpace builds the AlphaZero 8x8x73 action space. Plane slots which would move a piece off the
+// board are left out of the returned maps, so the action space size is always FullActionSpace while the maps
+// only hold the geometrically possible moves. Queen promotions are reachable both with and without the
+// "q" suffix in the reverse map.
+func fullActionSpace() (map[int32]Move, map[Move]int32) {
+	actionSpace := make(map[int32]Move, FullActionSpace)
+	reverseActionSpace := make(map[Move]int32, FullActionSpace)
+	add := func(plane int, from chess.Square, df, dr int, suffix string) {
+		to, ok := offset(from, df, dr)
+		if !ok {
+			return
+		}
+		idx := int32(plane*RowNum*ColNum + int(from))
+		m := Move(from.String() + to.String() + suffix)
+		actionSpace[idx] = m
+		reverseActionSpace[m] = idx
+	}
+
+	for sq := 0; sq < RowNum*ColNum; sq++ {
+		from := chess.Square(sq)
+		for d, dir := range queenDirections {
+			for dist := 1; dist <= maxQueenDistance; dist++ {
+				add(d*maxQueenDistance+dist-1, from, dir[0]*dist, dir[1]*dist, "")
+			}
+		}
+		for k, jump := range knightJumps {
+			add(knightPlaneOffset+k, from, jump[0], jump[1], "")
+		}
+
+		// only pawns on the seventh (white) or second (black) rank can promote.
+		var dr int
+		switch from.Rank() {
+		case chess.Rank7:
+			dr = 1
+		case chess.Rank2:
+			dr = -1
+		default:
+			continue
+		}
+		for p, promo := range underPromotions {
+			for df := -1; df <= 1; df++ {
+				add(promoPlaneOffset+p*3+df+1, from, df, dr, promo)
+			}
+		}
+	}
+
+	// queen promotions share the queen move planes.
+	for m, idx := range reverseActionSpace {
+		from, to := string(m[:2]), string(m[2:4])
+		if len(m) == 4 && isPromotionRank(from, to) {
+			reverseActionSpace[m+"q"] = idx
+		}
+	}
+	return actionSpace, reverseActionSpace
+}
+
+// offset returns the square df files and dr ranks away from sq.
+func offset(sq chess.Square, df, dr int) (chess.Square, bool) {
+	f := int(sq.File()) + df
+	r := int(sq.Rank()) + dr
+	if f < 0 || f >= ColNum || r < 0 || r >= RowNum {
+		return 0, false
+	}
+	return chess.Square(r*ColNum + f), true
+}
+
+// isPromotionRank checks whether a single step from the seventh to the eighth rank (or from the second to the
+// first) happens, which is when a pawn would promote.
+func isPromotionRank(from, to string) bool {
+	switch {
+	case from[1] == '7' && to[1] == '8':
+	case from[1] == '2' && to[1] == '1':
+	default:
+		return false
+	}
+	df := int(from[0]) - int(to[0])
+	return df >= -1 && df <= 1
+}
+
+// queenPromotion appends the queen promotion suffix to a move when it is a pawn reaching the last rank
+// on the given board.
+func queenPromotion(b *chess.Board, m Move) Move {
+	if len(m) != 4 || !isPromotionRank(string(m[:2]), string(m[2:])) {
+		return m
+	}
+	from, err := parseSquare(string(m[:2]))
+	if err != nil {
+		return m
+	}
+	if b.Piece(from).Type() != chess.Pawn {
+		return m
+	}
+	return m + "q"
+}
+
+func parseSquare(s string) (chess.Square, error) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return 0, fmt.Errorf("invalid square: %s", s)
+	}
+	return chess.Square(int(s[1]-'1')*ColNum + int(s[0]-'a')), nil
+}
@@ -0,0 +1,128 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+// roundTripFENs are positions covering black to move, castling and promotions of both colours.
+var roundTripFENs = []string{
+	"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+	"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1",
+	"r3k2r/pppppppp/8/8/8/8/PPPPPPPP/R3K2R w KQkq - 0 1",
+	"r3k2r/pppppppp/8/8/8/8/PPPPPPPP/R3K2R b KQkq - 0 1",
+	"1n1n3k/2P5/8/8/8/8/8/4K3 w - - 0 1",
+	"4k3/8/8/8/8/8/5p2/K3N1N1 b - - 0 1",
+}
+
+func TestActionSpaceRoundTrip(t *testing.T) {
+	promotions := make(map[string]int)
+	var castles int
+	for _, fen := range roundTripFENs {
+		g, err := ChessGameAZ().FromFEN(fen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		valid := g.history[g.histPtr].ValidMoves()
+		seen := make(map[int32]Move)
+		for _, vm := range valid {
+			m := Move(vm.String())
+			idx, err := g.MoveToNN(m)
+			if err != nil {
+				t.Errorf("%s: %v", fen, err)
+				continue
+			}
+			if idx < 0 || int(idx) >= g.ActionSpace() {
+				t.Errorf("%s: expected %s to have an index below %d. Got %d", fen, m, g.ActionSpace(), idx)
+			}
+			if other, ok := seen[idx]; ok {
+				t.Errorf("%s: expected distinct indices. %s and %s both have %d", fen, other, m, idx)
+			}
+			seen[idx] = m
+
+			back, err := g.NNToMove(idx)
+			if err != nil {
+				t.Errorf("%s: %v", fen, err)
+				continue
+			}
+			if back != m {
+				t.Errorf("%s: expected %s back from index %d. Got %s", fen, m, idx, back)
+			}
+
+			if vm.Promo() != chess.NoPieceType {
+				promotions[string(m[len(m)-1:])]++
+			}
+			if vm.HasTag(chess.KingSideCastle) || vm.HasTag(chess.QueenSideCastle) {
+				castles++
+			}
+		}
+		if possible := g.PossibleMoves(); len(possible) != len(valid) {
+			t.Errorf("%s: expected %d possible moves. Got %d", fen, len(valid), len(possible))
+		}
+	}
+
+	// both promotion positions allow a push and two captures
+	for _, p := range []string{"q", "r", "b", "n"} {
+		if promotions[p] != 6 {
+			t.Errorf("Expected 6 promotions to %s. Got %d", p, promotions[p])
+		}
+	}
+	if castles != 4 {
+		t.Errorf("Expected 4 castling moves. Got %d", castles)
+	}
+}
+
+func TestActionSpaceLayout(t *testing.T) {
+	g := ChessGameAZ()
+	cases := []struct {
+		m   Move
+		idx int32
+	}{
+		{"e2e4", 1*64 + int32(chess.E2)},                        // north, distance 2
+		{"g1f3", knightPlaneOffset*64 + 7*64 + int32(chess.G1)}, // knight jump (-1, 2)
+		{"e1g1", 2*7*64 + 1*64 + int32(chess.E1)},               // east, distance 2
+		{"c7b8n", promoPlaneOffset*64 + int32(chess.C7)},        // knight underpromotion to the west
+		{"f2f1r", (promoPlaneOffset+7)*64 + int32(chess.F2)},    // rook underpromotion straight ahead
+	}
+	for _, c := range cases {
+		idx, err := g.MoveToNN(c.m)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if idx != c.idx {
+			t.Errorf("Expected %s at index %d. Got %d", c.m, c.idx, idx)
+		}
+	}
+}
+
+func TestUnencodableMoves(t *testing.T) {
+	g := ChessGameFromMoves([]Move{"e2e4", "d2d4", "e7e5"})
+	if possible := g.PossibleMoves(); len(possible) != 2 {
+		t.Errorf("Expected 2 possible moves. Got %d", len(possible))
+	}
+	if missing := g.UnencodableMoves(); len(missing) != 18 {
+		t.Errorf("Expected 18 unencodable moves. Got %d: %v", len(missing), missing)
+	}
+
+	// games sharing the action space share the record, every move is kept once
+	c := g.Clone().(*Chess)
+	c.Apply("e2e4")
+	c.PossibleMoves()
+	g.PossibleMoves()
+	missing := g.UnencodableMoves()
+	if len(missing) != 18+19 {
+		t.Errorf("Expected %d unencodable moves. Got %d: %v", 18+19, len(missing), missing)
+	}
+	for i := 1; i < len(missing); i++ {
+		if missing[i-1] >= missing[i] {
+			t.Errorf("Expected sorted moves without duplicates. Got %v", missing)
+			break
+		}
+	}
+
+	if missing := ChessGameAZ().UnencodableMoves(); len(missing) != 0 {
+		t.Errorf("Expected no unencodable moves with the AlphaZero encoding. Got %v", missing)
+	}
+}
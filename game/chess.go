@@ -5,11 +5,49 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"sort"
 	"sync"
 
 	"github.com/notnil/chess"
 )
 
+// StartFEN is the FEN of the standard starting position.
+const StartFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+// unencodableMoves are the legal moves found missing from an action space. Each of them is logged once, as
+// PossibleMoves runs at every expansion of a search and would repeat it over and over.
+type unencodableMoves struct {
+	sync.Mutex
+	moves map[Move]struct{}
+}
+
+func newUnencodableMoves() *unencodableMoves {
+	return &unencodableMoves{moves: make(map[Move]struct{})}
+}
+
+// add records m, logging it the first time it is seen.
+func (u *unencodableMoves) add(m Move) {
+	u.Lock()
+	defer u.Unlock()
+	if _, ok := u.moves[m]; ok {
+		return
+	}
+	u.moves[m] = struct{}{}
+	log.Printf("move not in action space, skipping it: %s", m)
+}
+
+// list returns the recorded moves, sorted.
+func (u *unencodableMoves) list() []Move {
+	u.Lock()
+	defer u.Unlock()
+	moves := make([]Move, 0, len(u.moves))
+	for m := range u.moves {
+		moves = append(moves, m)
+	}
+	sort.Slice(moves, func(i, j int) bool { return moves[i] < moves[j] })
+	return moves
+}
+
 // Chess struct
 type Chess struct {
 	sync.Mutex
@@ -17,33 +55,52 @@ type Chess struct {
 	actionSpace        map[int32]Move
 	reverseActionSpace map[Move]int32
 	histPtr            int
+	fullEncoding       bool              // actions follow AlphaZero 8x8x73 encoding
+	unencodable        *unencodableMoves // shared by all games with the same action space
 }
 
 // ChessGame returns new Chess game state.
 // fileMoves is a file containing 'almost' all possible UCI notation moves
 // each move is one line.
 func ChessGame(movesFile string) *Chess {
-	f, err := os.Open(movesFile)
+	actionSpace, reverseActionSpace, err := loadActionSpace(movesFile)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer f.Close()
 
-	scanner := bufio.NewScanner(f)
-
-	actionSpace := make(map[int32]Move)
-	reverseActionSpace := make(map[Move]int32)
-	var idx int32
-	for scanner.Scan() {
-		m := Move(scanner.Text())
-		actionSpace[idx] = m
-		reverseActionSpace[m] = idx
-		idx++
+	// new game with UCI notation
+	g := chess.NewGame(chess.UseNotation(chess.UCINotation{}))
+	return &Chess{
+		Mutex:              sync.Mutex{},
+		history:            []chess.Game{*g},
+		actionSpace:        actionSpace,
+		reverseActionSpace: reverseActionSpace,
+		histPtr:            0,
+		unencodable:        newUnencodableMoves(),
 	}
+}
 
-	if err := scanner.Err(); err != nil {
-		log.Fatal(err)
+// ChessGameAZ returns new Chess game state using the AlphaZero 8x8x73 move encoding, so no moves file is needed.
+// Every legal move has its own neural network index and the action space is always FullActionSpace.
+func ChessGameAZ() *Chess {
+	actionSpace, reverseActionSpace := fullActionSpace()
+
+	// new game with UCI notation
+	g := chess.NewGame(chess.UseNotation(chess.UCINotation{}))
+	return &Chess{
+		Mutex:              sync.Mutex{},
+		history:            []chess.Game{*g},
+		actionSpace:        actionSpace,
+		reverseActionSpace: reverseActionSpace,
+		histPtr:            0,
+		fullEncoding:       true,
+		unencodable:        newUnencodableMoves(),
 	}
+}
+
+// ChessGameFromMoves returns new Chess game state whose action space is moves, in neural network index order.
+func ChessGameFromMoves(moves []Move) *Chess {
+	actionSpace, reverseActionSpace := actionSpaceFromMoves(moves)
 
 	// new game with UCI notation
 	g := chess.NewGame(chess.UseNotation(chess.UCINotation{}))
@@ -53,14 +110,102 @@ func ChessGame(movesFile string) *Chess {
 		actionSpace:        actionSpace,
 		reverseActionSpace: reverseActionSpace,
 		histPtr:            0,
+		unencodable:        newUnencodableMoves(),
 	}
 }
 
+// FromFEN returns new Chess game state with the action space of g starting from the position described by fen,
+// e.g. ChessGameAZ().FromFEN(fen). Reset returns to this position instead of the standard initial one.
+func (g *Chess) FromFEN(fen string) (*Chess, error) {
+	fenOpt, err := chess.FEN(fen)
+	if err != nil {
+		return nil, err
+	}
+
+	// new game with UCI notation
+	ng := chess.NewGame(fenOpt, chess.UseNotation(chess.UCINotation{}))
+	return &Chess{
+		Mutex:              sync.Mutex{},
+		history:            []chess.Game{*ng},
+		actionSpace:        g.actionSpace,
+		reverseActionSpace: g.reverseActionSpace,
+		histPtr:            0,
+		fullEncoding:       g.fullEncoding,
+		unencodable:        g.unencodable,
+	}, nil
+}
+
+// LoadMoves reads the moves of a moves file, each move is one line.
+func LoadMoves(movesFile string) ([]Move, error) {
+	f, err := os.Open(movesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	var moves []Move
+	for scanner.Scan() {
+		moves = append(moves, Move(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return moves, nil
+}
+
+// loadActionSpace reads the action space from a moves file, each move is one line.
+func loadActionSpace(movesFile string) (map[int32]Move, map[Move]int32, error) {
+	moves, err := LoadMoves(movesFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	actionSpace, reverseActionSpace := actionSpaceFromMoves(moves)
+	return actionSpace, reverseActionSpace, nil
+}
+
+// actionSpaceFromMoves builds the action space maps of moves, the index of a move is its position in moves.
+func actionSpaceFromMoves(moves []Move) (map[int32]Move, map[Move]int32) {
+	actionSpace := make(map[int32]Move, len(moves))
+	reverseActionSpace := make(map[Move]int32, len(moves))
+	for i, m := range moves {
+		actionSpace[int32(i)] = m
+		reverseActionSpace[m] = int32(i)
+	}
+	return actionSpace, reverseActionSpace
+}
+
+// FullEncoding reports whether the game uses the AlphaZero 8x8x73 move encoding.
+func (g *Chess) FullEncoding() bool {
+	return g.fullEncoding
+}
+
+// Moves returns the moves of the action space in neural network index order. It returns nil for the AlphaZero
+// move encoding, which is fixed.
+func (g *Chess) Moves() []Move {
+	if g.fullEncoding {
+		return nil
+	}
+	moves := make([]Move, len(g.actionSpace))
+	for idx, m := range g.actionSpace {
+		moves[idx] = m
+	}
+	return moves
+}
+
 // ActionSpace returns the number of permissible actions.
 func (g *Chess) ActionSpace() int {
+	if g.fullEncoding {
+		return FullActionSpace
+	}
 	return len(g.actionSpace)
 }
 
+// FEN returns the current position in FEN notation.
+func (g *Chess) FEN() string {
+	return g.history[g.histPtr].FEN()
+}
+
 // Board returns board state.
 func (g *Chess) Board() *chess.Board {
 	return g.history[g.histPtr].Position().Board()
@@ -76,6 +221,11 @@ func (g *Chess) MoveNumber() int {
 	return g.histPtr
 }
 
+// Positions returns positions that led to this point, the last one is the current position.
+func (g *Chess) Positions() []*chess.Position {
+	return g.history[g.histPtr].Positions()
+}
+
 // LastMove returns the last move that was made in neural network index.
 func (g *Chess) LastMove() int32 {
 	var idx int32
@@ -99,9 +249,21 @@ func (g *Chess) NNToMove(idx int32) (Move, error) {
 	if m, ok = g.actionSpace[idx]; !ok {
 		return "", fmt.Errorf("invalid index: %d", idx)
 	}
+	if g.fullEncoding {
+		m = queenPromotion(g.Board(), m)
+	}
 	return m, nil
 }
 
+// MoveToNN returns the neural network encoding output index of a move.
+func (g *Chess) MoveToNN(m Move) (int32, error) {
+	idx, ok := g.reverseActionSpace[m]
+	if !ok {
+		return 0, fmt.Errorf("move not in action space: %s", m)
+	}
+	return idx, nil
+}
+
 // Ended returns true if ended and the winner color.
 func (g *Chess) Ended() (ended bool, winner chess.Color) {
 	r := g.history[g.histPtr].Outcome()
@@ -122,6 +284,11 @@ func (g *Chess) Ended() (ended bool, winner chess.Color) {
 	return
 }
 
+// Method returns the method by which the game ended.
+func (g *Chess) Method() chess.Method {
+	return g.history[g.histPtr].Method()
+}
+
 // Resign resigns the game and mark the game as ended.
 func (g *Chess) Resign(color chess.Color) {
 	g.history[g.histPtr].Resign(color)
@@ -159,17 +326,29 @@ func (g *Chess) Apply(m Move) State {
 	return g
 }
 
-// PossibleMoves gets all possible moves in output index format.
+// PossibleMoves gets all possible moves in output index format. Legal moves outside of the action space are left
+// out, see UnencodableMoves.
 func (g *Chess) PossibleMoves() []int32 {
 	moves := g.history[g.histPtr].ValidMoves()
-	mIdx := make([]int32, len(moves))
-	for i, m := range moves {
-		mIdx[i] = g.reverseActionSpace[Move(m.String())]
+	mIdx := make([]int32, 0, len(moves))
+	for _, m := range moves {
+		idx, ok := g.reverseActionSpace[Move(m.String())]
+		if !ok {
+			g.unencodable.add(Move(m.String()))
+			continue
+		}
+		mIdx = append(mIdx, idx)
 	}
 	return mIdx
 }
 
-// Reset resets state.
+// UnencodableMoves returns the legal moves PossibleMoves left out because they are not in the action space, in
+// this game or any other game sharing its action space.
+func (g *Chess) UnencodableMoves() []Move {
+	return g.unencodable.list()
+}
+
+// Reset resets state to the root position the game was created with.
 func (g *Chess) Reset() {
 	g.history = g.history[:1] // reset to first state
 	g.histPtr = 0
@@ -195,27 +374,28 @@ func (g *Chess) Eq(other State) bool {
 	if !ok {
 		panic("cannot cast to chess game state")
 	}
-	return ot.history[ot.histPtr].Position().Hash() == g.history[g.histPtr].Position().Hash()
+	return ot.Hash() == g.Hash()
+}
 
+// Hash returns the hash of the current position.
+func (g *Chess) Hash() [16]byte {
+	return g.history[g.histPtr].Position().Hash()
 }
 
 // Clone clones state.
+// The action space maps are never modified after construction so the clone shares them.
 func (g *Chess) Clone() State {
 	g.Lock()
 	n := &Chess{
 		Mutex:              sync.Mutex{},
 		history:            make([]chess.Game, len(g.history)),
-		actionSpace:        make(map[int32]Move, 0),
-		reverseActionSpace: make(map[Move]int32, 0),
+		actionSpace:        g.actionSpace,
+		reverseActionSpace: g.reverseActionSpace,
 		histPtr:            g.histPtr,
+		fullEncoding:       g.fullEncoding,
+		unencodable:        g.unencodable,
 	}
 	copy(n.history, g.history)
-	for k, v := range g.actionSpace {
-		n.actionSpace[k] = v
-	}
-	for k, v := range g.reverseActionSpace {
-		n.reverseActionSpace[k] = v
-	}
 
 	g.Unlock()
 	return n
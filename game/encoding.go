@@ -1,6 +1,72 @@
 package game
 
-import "github.com/notnil/chess"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// encoding constant variables.
+const (
+	InputPlanes   = 2  // number of planes produced by InputEncoder
+	HistoryLength = 8  // number of positions used by AlphaZero
+	piecePlanes   = 12 // one-hot planes for 6 piece types of both colors
+	repPlanes     = 2  // position repeated once, position repeated twice
+	stepPlanes    = piecePlanes + repPlanes
+	constPlanes   = 7 // color, move count, 4 castling rights, no-progress count
+)
+
+// names of the input encoders.
+const (
+	SimpleEncoderName  = "simple"
+	HistoryEncoderName = "history"
+)
+
+// EncoderInfo identifies an input encoding. It is stored in checkpoints so that a network is always fed the same
+// planes it was trained on.
+type EncoderInfo struct {
+	Name    string `json:"name"`
+	Version int    `json:"version"`
+	Planes  int    `json:"planes"` // number of feature planes
+}
+
+// Encoder is an input encoder that knows its identity.
+type Encoder interface {
+	Info() EncoderInfo
+	Encode(g State) []float32
+}
+
+// NewEncoder returns the encoder identified by info.
+func NewEncoder(info EncoderInfo) (Encoder, error) {
+	switch info.Name {
+	case SimpleEncoderName:
+		e := SimpleEncoder{}
+		if e.Info() == info {
+			return e, nil
+		}
+	case HistoryEncoderName:
+		if info.Planes > constPlanes && (info.Planes-constPlanes)%stepPlanes == 0 {
+			e := HistoryEncoder{T: (info.Planes - constPlanes) / stepPlanes}
+			if e.Info() == info {
+				return e, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown input encoder %+v", info)
+}
+
+// SimpleEncoder is the Encoder of InputEncoder.
+type SimpleEncoder struct{}
+
+// Info returns the identity of the encoder.
+func (SimpleEncoder) Info() EncoderInfo {
+	return EncoderInfo{Name: SimpleEncoderName, Version: 1, Planes: InputPlanes}
+}
+
+// Encode encodes game state to neural input format.
+func (SimpleEncoder) Encode(g State) []float32 { return InputEncoder(g) }
 
 // InputEncoder encodes game state to neural input format.
 func InputEncoder(g State) []float32 {
@@ -22,3 +88,97 @@ func InputEncoder(g State) []float32 {
 	inputLayer := append(board, playerLayer...)
 	return inputLayer
 }
+
+// HistoryEncoder is the AlphaZero style input encoder. For each of the last T positions it emits 12 one-hot
+// piece planes (white king to pawn, then black king to pawn) and 2 repetition planes, followed by constant planes
+// for the side to move, total move count, castling rights (white king side, white queen side, black king side,
+// black queen side) and no-progress count. Positions before the start of the game are left as zeroes.
+// With T = HistoryLength this gives the 119 planes from the paper.
+type HistoryEncoder struct {
+	T int // number of history positions
+}
+
+// Planes returns the number of feature planes the encoder produces.
+func (e HistoryEncoder) Planes() int {
+	return e.T*stepPlanes + constPlanes
+}
+
+// Info returns the identity of the encoder.
+func (e HistoryEncoder) Info() EncoderInfo {
+	return EncoderInfo{Name: HistoryEncoderName, Version: 1, Planes: e.Planes()}
+}
+
+// Encode encodes game state to neural input format.
+func (e HistoryEncoder) Encode(g State) []float32 {
+	const planeSize = RowNum * ColNum
+	retVal := make([]float32, e.Planes()*planeSize)
+	fill := func(plane int, v float32) {
+		p := retVal[plane*planeSize : (plane+1)*planeSize]
+		for i := range p {
+			p[i] = v
+		}
+	}
+
+	positions := g.Positions()
+	for t := 0; t < e.T && t < len(positions); t++ {
+		cur := len(positions) - 1 - t
+		pos := positions[cur]
+		offset := t * stepPlanes
+		for sq, p := range pos.Board().SquareMap() {
+			if p == chess.NoPiece {
+				continue
+			}
+			retVal[(offset+int(p)-1)*planeSize+int(sq)] = 1
+		}
+
+		reps := repetitions(positions[:cur], pos)
+		for r := 0; r < repPlanes && r < reps; r++ {
+			fill(offset+piecePlanes+r, 1)
+		}
+	}
+
+	pos := positions[len(positions)-1]
+	offset := e.T * stepPlanes
+	if pos.Turn() == chess.White {
+		fill(offset, 1)
+	}
+	halfMoves, moveCount := clocks(pos)
+	fill(offset+1, float32(moveCount))
+	cr := pos.CastleRights()
+	castles := [4]bool{
+		cr.CanCastle(chess.White, chess.KingSide),
+		cr.CanCastle(chess.White, chess.QueenSide),
+		cr.CanCastle(chess.Black, chess.KingSide),
+		cr.CanCastle(chess.Black, chess.QueenSide),
+	}
+	for i, ok := range castles {
+		if ok {
+			fill(offset+2+i, 1)
+		}
+	}
+	fill(offset+6, float32(halfMoves))
+	return retVal
+}
+
+// repetitions counts how many times pos has occurred in previous positions.
+func repetitions(previous []*chess.Position, pos *chess.Position) int {
+	var count int
+	h := pos.Hash()
+	for _, p := range previous {
+		if p.Hash() == h {
+			count++
+		}
+	}
+	return count
+}
+
+// clocks returns the half move clock and full move count of a position, read from its FEN.
+func clocks(pos *chess.Position) (halfMoves, moveCount int) {
+	fields := strings.Fields(pos.String())
+	if len(fields) != 6 {
+		return 0, 0
+	}
+	halfMoves, _ = strconv.Atoi(fields[4])
+	moveCount, _ = strconv.Atoi(fields[5])
+	return halfMoves, moveCount
+}
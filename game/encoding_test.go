@@ -0,0 +1,166 @@
+package game
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+const planeSize = RowNum * ColNum
+
+// plane returns the i-th plane of an encoding.
+func plane(enc []float32, i int) []float32 {
+	return enc[i*planeSize : (i+1)*planeSize]
+}
+
+// constant returns the value of a plane filled with one value, and whether it is filled with one value.
+func constant(p []float32) (float32, bool) {
+	for _, v := range p {
+		if v != p[0] {
+			return 0, false
+		}
+	}
+	return p[0], true
+}
+
+func playMoves(t *testing.T, moves ...Move) *Chess {
+	g := ChessGameAZ()
+	for _, m := range moves {
+		if !g.Check(m) {
+			t.Fatalf("Expected %s to be legal in %s", m, g.FEN())
+		}
+		g.Apply(m)
+	}
+	return g
+}
+
+// halfMoves returns the half move clock of the FEN of g.
+func halfMoves(t *testing.T, g *Chess) float32 {
+	fields := strings.Fields(g.FEN())
+	n, err := strconv.Atoi(fields[4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return float32(n)
+}
+
+func checkConstant(t *testing.T, enc []float32, i int, expected float32) {
+	t.Helper()
+	v, ok := constant(plane(enc, i))
+	if !ok {
+		t.Errorf("Expected plane %d to be constant", i)
+		return
+	}
+	if v != expected {
+		t.Errorf("Expected plane %d to be %v. Got %v", i, expected, v)
+	}
+}
+
+func TestHistoryEncoderPlanes(t *testing.T) {
+	e := HistoryEncoder{T: HistoryLength}
+	if e.Planes() != 119 {
+		t.Errorf("Expected 119 planes. Got %d", e.Planes())
+	}
+	enc := e.Encode(ChessGameAZ())
+	if len(enc) != 119*planeSize {
+		t.Errorf("Expected an encoding of %d values. Got %d", 119*planeSize, len(enc))
+	}
+
+	// at the start only the current position is known, its pieces are one-hot
+	pieces := []struct {
+		p  chess.Piece
+		sq chess.Square
+	}{
+		{chess.WhiteKing, chess.E1},
+		{chess.WhiteQueen, chess.D1},
+		{chess.WhitePawn, chess.A2},
+		{chess.BlackKnight, chess.G8},
+		{chess.BlackPawn, chess.H7},
+	}
+	for _, c := range pieces {
+		if v := plane(enc, int(c.p)-1)[c.sq]; v != 1 {
+			t.Errorf("Expected %v on %v. Got %v", c.p, c.sq, v)
+		}
+	}
+	var sum float32
+	for _, v := range enc[:piecePlanes*planeSize] {
+		sum += v
+	}
+	if sum != 32 {
+		t.Errorf("Expected 32 pieces. Got %v", sum)
+	}
+	for _, v := range enc[piecePlanes*planeSize : HistoryLength*stepPlanes*planeSize] {
+		if v != 0 {
+			t.Fatal("Expected no history before the start of the game")
+		}
+	}
+}
+
+func TestHistoryEncoderRepetitions(t *testing.T) {
+	e := HistoryEncoder{T: HistoryLength}
+	shuffle := []Move{"g1f3", "g8f6", "f3g1", "f6g8"}
+	g := playMoves(t, append(shuffle, shuffle...)...)
+	enc := e.Encode(g)
+
+	// the start position now occurs for the third time
+	checkConstant(t, enc, piecePlanes, 1)
+	checkConstant(t, enc, piecePlanes+1, 1)
+	// the positions of the last 4 plies occurred once before, the earlier ones are new
+	for step := 1; step < HistoryLength; step++ {
+		var once float32
+		if step <= 4 {
+			once = 1
+		}
+		checkConstant(t, enc, step*stepPlanes+piecePlanes, once)
+		checkConstant(t, enc, step*stepPlanes+piecePlanes+1, 0)
+	}
+
+	// the history is ordered from the current position backwards
+	if v := plane(enc, 1*stepPlanes+int(chess.BlackKnight)-1)[chess.F6]; v != 1 {
+		t.Errorf("Expected a black knight on f6 one ply ago. Got %v", v)
+	}
+	if v := plane(enc, int(chess.BlackKnight)-1)[chess.G8]; v != 1 {
+		t.Errorf("Expected a black knight on g8 now. Got %v", v)
+	}
+}
+
+func TestHistoryEncoderConstantPlanes(t *testing.T) {
+	e := HistoryEncoder{T: HistoryLength}
+	offset := HistoryLength * stepPlanes
+
+	enc := e.Encode(ChessGameAZ())
+	checkConstant(t, enc, offset, 1)   // white to move
+	checkConstant(t, enc, offset+1, 1) // move count
+	for i := 0; i < 4; i++ {
+		checkConstant(t, enc, offset+2+i, 1)
+	}
+	checkConstant(t, enc, offset+6, 0)
+
+	g := playMoves(t, "e2e4")
+	enc = e.Encode(g)
+	checkConstant(t, enc, offset, 0) // black to move
+	checkConstant(t, enc, offset+1, 1)
+
+	// the white king walks, white loses both castling rights
+	g = playMoves(t, "e2e4", "e7e5", "e1e2")
+	enc = e.Encode(g)
+	checkConstant(t, enc, offset, 0)
+	checkConstant(t, enc, offset+1, 2)
+	castling := []float32{0, 0, 1, 1}
+	for i, c := range castling {
+		checkConstant(t, enc, offset+2+i, c)
+	}
+	checkConstant(t, enc, offset+6, halfMoves(t, g))
+
+	// the black rook walks, black loses the king side
+	g = playMoves(t, "e2e4", "e7e5", "e1e2", "g8f6", "g2g3", "h8g8")
+	enc = e.Encode(g)
+	checkConstant(t, enc, offset, 1)
+	castling = []float32{0, 0, 0, 1}
+	for i, c := range castling {
+		checkConstant(t, enc, offset+2+i, c)
+	}
+	checkConstant(t, enc, offset+6, halfMoves(t, g))
+}
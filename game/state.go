@@ -19,13 +19,17 @@ type State interface {
 	// These methods represent the game state
 	ActionSpace() int                 // returns the number of permissible actions.
 	Board() *chess.Board              // return board state.
+	FEN() string                      // return the current position in FEN notation.
 	Turn() chess.Color                // Turn returns the color to move next.
 	MoveNumber() int                  // returns count of moves so far that led to this point.
 	LastMove() int32                  // returns the last move that was made in neural network index.
 	NNToMove(idx int32) (Move, error) // returns move from neural network encoding output space.
+	MoveToNN(m Move) (int32, error)   // returns neural network encoding output index of a move.
+	Positions() []*chess.Position     // returns positions that led to this point, oldest first.
 
 	// Meta-game stuff
 	Ended() (ended bool, winner chess.Color) // has the game ended? if yes, then who's the winner?
+	Method() chess.Method                    // how has the game ended?
 	Resign(color chess.Color)                // current player resign the game.
 
 	// interactions
@@ -39,6 +43,7 @@ type State interface {
 	Fwd()          // forward move.
 
 	// generics
+	Hash() [16]byte      // hash of the current position, equal for equal states.
 	Eq(other State) bool // check 2 states if they are equal or not.
 	Clone() State        // clone states.
 	ShowBoard()          // show the current board position.
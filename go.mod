@@ -14,7 +14,7 @@ require (
 	golang.org/x/exp v0.0.0-20210503015746-b3083d562e1d
 	golang.org/x/image v0.0.0-20210216034530-4410531fe030
 	gonum.org/v1/gonum v0.9.1
-	gorgonia.org/gorgonia v0.9.17-0.20210124090702-531c6df2c434
+	gorgonia.org/gorgonia v0.9.17-0.20210124090702-531c6df2c434 // pinned, dualnet/batchnorm.go reads unexported fields of BatchNormOp
 	gorgonia.org/tensor v0.9.18
 	gorgonia.org/vecf32 v0.9.0
 )
@@ -0,0 +1,44 @@
+// Package atomicfile writes files so that readers and crashes never see them partially written.
+package atomicfile
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Write writes a file by writing to a temporary file in the same directory and renaming it over filename, so that
+// a crash never leaves a partially written file behind.
+func Write(filename string, perm os.FileMode, write func(w io.Writer) error) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp := f.Name()
+	if err := write(f); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return errors.WithStack(err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return errors.WithStack(err)
+	}
+	if err := os.Chmod(tmp, perm); err != nil {
+		os.Remove(tmp)
+		return errors.WithStack(err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		os.Remove(tmp)
+		return errors.WithStack(err)
+	}
+	return nil
+}
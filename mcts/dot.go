@@ -0,0 +1,99 @@
+package mcts
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/alphabeth/game"
+	"github.com/awalterschulze/gographviz"
+)
+
+const dotGraphName = "mcts"
+
+// ToDot exports the tree below the current root as a graph in the DOT language.
+// Only the topK most visited children of every node are written and the tree is cut off maxDepth moves below
+// the root; zero values mean no limit. Nodes are labelled with the move, N(s, a), Q(s, a), P(s, a) and the status,
+// edges are labelled and weighted with the share of the parent's visits that went to the child.
+func (t *MCTS) ToDot(topK, maxDepth int) (string, error) {
+	g := gographviz.NewGraph()
+	if err := g.SetName(dotGraphName); err != nil {
+		return "", err
+	}
+	if err := g.SetDir(true); err != nil {
+		return "", err
+	}
+	if t.root == nilNode {
+		return g.String(), nil
+	}
+
+	root := t.nodeFromNaughty(t.root)
+	label := fmt.Sprintf("root\\nN=%d Q=%.3f", t.RootVisits(), t.RootValue())
+	if err := g.AddNode(dotGraphName, dotName(t.root), map[string]string{
+		"label": dotQuote(label),
+		"shape": "box",
+	}); err != nil {
+		return "", err
+	}
+	if err := t.dotChildren(g, root, t.current.Clone().(game.State), topK, maxDepth, 1); err != nil {
+		return "", err
+	}
+	return g.String(), nil
+}
+
+// dotChildren adds the children of n in state to the graph and recurses into them.
+func (t *MCTS) dotChildren(g *gographviz.Graph, n *Node, state game.State, topK, maxDepth, depth int) error {
+	if maxDepth > 0 && depth > maxDepth {
+		return nil
+	}
+
+	var children []*Node
+	var parentVisits uint32
+	for _, kid := range t.Children(n.id) {
+		child := t.nodeFromNaughty(kid)
+		if !child.IsValid() {
+			continue
+		}
+		children = append(children, child)
+		parentVisits += child.Visits()
+	}
+	sort.SliceStable(children, func(i, j int) bool { return children[i].Visits() > children[j].Visits() })
+	if topK > 0 && len(children) > topK {
+		children = children[:topK]
+	}
+
+	for _, child := range children {
+		move, err := state.NNToMove(child.Move())
+		if err != nil {
+			return err
+		}
+		label := fmt.Sprintf("%s\\nN=%d Q=%.3f P=%.3f\\n%v", move, child.Visits(), child.QSA(), child.PSA(), child.Status())
+		if err := g.AddNode(dotGraphName, dotName(child.id), map[string]string{
+			"label": dotQuote(label),
+		}); err != nil {
+			return err
+		}
+
+		share := float64(child.Visits()) / float64(parentVisits)
+		if err := g.AddEdge(dotName(n.id), dotName(child.id), true, map[string]string{
+			"label":    dotQuote(fmt.Sprintf("%.2f", share)),
+			"weight":   fmt.Sprintf("%.3f", share),
+			"penwidth": fmt.Sprintf("%.2f", 1+4*share),
+		}); err != nil {
+			return err
+		}
+
+		if !child.HasChildren() || !state.Check(move) {
+			continue
+		}
+		next := state.Clone().Apply(move).(game.State)
+		if err := t.dotChildren(g, child, next, topK, maxDepth, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func dotName(n Naughty) string { return fmt.Sprintf("n%d", n) }
+
+// dotQuote quotes a label, keeping its \n line breaks as DOT escapes.
+func dotQuote(s string) string { return `"` + s + `"` }
@@ -0,0 +1,76 @@
+package mcts
+
+import (
+	"sort"
+	"time"
+
+	"github.com/chewxy/math32"
+)
+
+// ChildInfo holds the search statistics of a child of the root.
+type ChildInfo struct {
+	Move   int32   // neural network move index
+	Visits uint32  // N(s, a)
+	Q      float32 // Q(s, a) from the perspective of the player to move at the root
+	P      float32 // prior probability P(s, a), including the exploration noise
+	Score  float32 // PUCT score Q(s, a) + U(s, a) which is used to select the child
+}
+
+// SearchInfo holds the statistics of the current or last search.
+type SearchInfo struct {
+	Value    float32     // value of the root from the perspective of the player to move
+	Children []ChildInfo // the root children, most visited first
+	PV       []int32     // principal variation following the most visited children
+	SelDepth int         // deepest number of moves below the root reached by a playout
+
+	Nodes          int           // number of nodes in the tree
+	Playouts       int           // number of finished playouts
+	Elapsed        time.Duration // wall-clock time of the search
+	NodesPerSecond float64       // finished playouts per second, as reported by chess engines
+}
+
+// SearchInfo returns the statistics of the search. It may be called while a search is running, the snapshot is
+// taken while the search cannot move the root or free nodes.
+func (t *MCTS) SearchInfo() SearchInfo {
+	t.infoLock.RLock()
+	defer t.infoLock.RUnlock()
+
+	var info SearchInfo
+	info.Playouts, info.SelDepth, info.Nodes, info.Elapsed = t.progress()
+	if info.Elapsed > 0 {
+		info.NodesPerSecond = float64(info.Playouts) / info.Elapsed.Seconds()
+	}
+
+	if t.root == nilNode {
+		return info
+	}
+	info.Value = t.RootValue()
+	info.PV = t.PrincipalVariation()
+
+	children := t.Children(t.root)
+	var parentVisits uint32
+	for _, kid := range children {
+		child := t.nodeFromNaughty(kid)
+		if child.IsValid() {
+			parentVisits += child.Visits()
+		}
+	}
+	numerator := math32.Sqrt(float32(parentVisits))
+	for _, kid := range children {
+		child := t.nodeFromNaughty(kid)
+		if !child.IsValid() {
+			continue
+		}
+		info.Children = append(info.Children, ChildInfo{
+			Move:   child.Move(),
+			Visits: child.Visits(),
+			Q:      child.QSA(),
+			P:      child.PSA(),
+			Score:  child.score(t.PUCT, numerator),
+		})
+	}
+	sort.SliceStable(info.Children, func(i, j int) bool {
+		return info.Children[i].Visits > info.Children[j].Visits
+	})
+	return info
+}
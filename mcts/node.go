@@ -40,6 +40,7 @@ type Node struct {
 	qsa         float32 // the expected reward for taking action a from state s, i.e: Q(s,a)
 	hasChildren bool
 	psa         float32 // neural network policy estimation for taking the move from state s, i.e: P(s, a)
+	prior       float32 // P(s, a) as given by the neural network, before any noise was added
 	pi          float32 // improved policies
 
 	// Naughty things
@@ -123,6 +124,13 @@ func (n *Node) Invalidate() {
 	n.status = uint32(Invalid)
 }
 
+// Status returns the status of the node.
+func (n *Node) Status() Status {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return Status(n.status)
+}
+
 // IsValid returns true if it's valid
 func (n *Node) IsValid() bool {
 	n.lock.Lock()
@@ -161,6 +169,13 @@ func (n *Node) SetHasChild(f bool) {
 	n.hasChildren = f
 }
 
+// SetNoise mixes noise into the neural network prior: P(s, a) = (1 - epsilon) * prior + epsilon * noise.
+func (n *Node) SetNoise(epsilon, noise float32) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.psa = (1-epsilon)*n.prior + epsilon*noise
+}
+
 // SetPi sets Pi.
 func (n *Node) SetPi(p float32) {
 	n.pi = p
@@ -209,17 +224,7 @@ func (n *Node) Select() Naughty {
 			continue
 		}
 
-		qsa := float32(0)
-		visits := child.Visits()
-		if visits > 0 {
-			qsa = child.QSA() // but if this node has been visited before, Q from the node is used.
-		}
-		psa := child.PSA()
-		denominator := 1.0 + float32(visits)
-		lastTerm := numerator / denominator
-		puct := tree.PUCT * psa * lastTerm
-		usa := qsa + puct
-
+		usa := child.score(tree.PUCT, numerator)
 		if usa > bestValue {
 			bestValue = usa
 			best = kid
@@ -232,6 +237,51 @@ func (n *Node) Select() Naughty {
 	return best
 }
 
+// score returns the PUCT score Q(s, a) + U(s, a) of the node, numerator is the square root of the parent visits.
+func (n *Node) score(c, numerator float32) float32 {
+	qsa := float32(0)
+	visits := n.Visits()
+	if visits > 0 {
+		qsa = n.QSA() // but if this node has been visited before, Q from the node is used.
+	}
+	psa := n.PSA()
+	denominator := 1.0 + float32(visits)
+	lastTerm := numerator / denominator
+	puct := c * psa * lastTerm
+	return qsa + puct
+}
+
+// SelectVirtual selects the best child like Select and applies a virtual loss of vl to it in the same critical
+// section, so that concurrent simulations descending through this node see the pending visit and spread out
+// over other children. The virtual loss has to be reverted with RevertVirtualLoss once the simulation is done.
+func (n *Node) SelectVirtual(vl float32) Naughty {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	best := n.Select()
+	tree := treeFromUintptr(n.tree)
+	tree.nodeFromNaughty(best).addVirtualLoss(vl)
+	return best
+}
+
+// RevertVirtualLoss reverts a virtual loss of vl applied by SelectVirtual.
+func (n *Node) RevertVirtualLoss(vl float32) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.visits <= 1 {
+		return
+	}
+	n.qsa = (float32(n.visits)*n.qsa + vl) / float32(n.visits-1)
+	n.visits--
+}
+
+// addVirtualLoss counts a visit with a loss of vl, as if the simulation in flight lost.
+func (n *Node) addVirtualLoss(vl float32) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.qsa = (float32(n.visits)*n.qsa - vl) / float32(n.visits+1)
+	n.visits++
+}
+
 // accumulate updates Q(s, a) thread-safe.
 func (n *Node) accumulate(v float32) {
 	n.lock.Lock()
@@ -276,4 +326,5 @@ func (n *Node) reset() {
 	n.qsa = 0
 	n.hasChildren = false
 	n.psa = 0
+	n.prior = 0
 }
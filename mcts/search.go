@@ -1,23 +1,25 @@
 package mcts
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
 	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/alphabeth/game"
 	"github.com/chewxy/math32"
 	"github.com/hashicorp/go-multierror"
 	"github.com/notnil/chess"
+	distrand "golang.org/x/exp/rand"
+	"gonum.org/v1/gonum/stat/distmv"
 )
 
 const (
-	maxTreeSize    = 25000000 // a tree is at max allowed this many nodes - at about 56 bytes per node that is 1.2GB of memory required
-	epsilon        = 0.25     // For adding Dirichlet noise.
-	dirichletParam = 0.3
+	maxTreeSize = 25000000 // a tree is at max allowed this many nodes - at about 56 bytes per node that is 1.2GB of memory required
 )
 
 // Inferencer is essentially the neural network
@@ -31,6 +33,12 @@ type searchState struct {
 	root          Naughty
 	wg            *sync.WaitGroup
 	maxDepth      int
+
+	// statistics of the current or last search, atomic pls. They are reset while holding infoLock.
+	started  int64 // unix nanoseconds
+	finished int64 // unix nanoseconds, 0 while searching
+	playouts int64
+	selDepth int32
 }
 
 func (s *searchState) nodeCount() int32 {
@@ -38,21 +46,84 @@ func (s *searchState) nodeCount() int32 {
 	return atomic.LoadInt32(&t.nc)
 }
 
+// progress returns the statistics of the current or last search, the caller must hold infoLock for reading.
+func (s *searchState) progress() (playouts, selDepth, nodes int, elapsed time.Duration) {
+	playouts = int(atomic.LoadInt64(&s.playouts))
+	selDepth = int(atomic.LoadInt32(&s.selDepth))
+	nodes = int(s.nodeCount())
+	if started := atomic.LoadInt64(&s.started); started > 0 {
+		finished := atomic.LoadInt64(&s.finished)
+		if finished == 0 {
+			finished = time.Now().UnixNano()
+		}
+		elapsed = time.Duration(finished - started)
+	}
+	return
+}
+
+// Budget limits a search. The search stops as soon as any of the limits is reached, zero values mean no limit.
+type Budget struct {
+	Playouts int           // maximum number of playouts
+	Nodes    int           // maximum number of nodes in the tree
+	Duration time.Duration // maximum wall-clock time
+	Workers  int           // number of concurrent playouts, defaults to NumSimulation
+}
+
 // Search using Monte Carlo tree to do simulation and get the best move. Note that we should check for checkmate
 // first before running this function
 func (t *MCTS) Search() (game.Move, error) {
-	t.updateRoot()
+	return t.SearchWithBudget(context.Background(), Budget{Playouts: t.NumSimulation})
+}
 
-	for _, f := range t.freeables {
-		t.free(f)
+// SearchWithBudget runs playouts with a fixed pool of workers until the budget is used up or ctx is done, then
+// returns the best move found so far. Playouts which have already started are finished before it returns.
+// Expanding a new root counts as a playout. A ctx which is already done returns its error without evaluating
+// anything.
+func (t *MCTS) SearchWithBudget(ctx context.Context, budget Budget) (game.Move, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
 	}
+	var cancel context.CancelFunc
+	if budget.Duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, budget.Duration)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
 
+	expanded, err := t.prepareSearch()
+	if err != nil {
+		return "", err
+	}
+	defer func() { atomic.StoreInt64(&t.finished, time.Now().UnixNano()) }()
+	root := t.nodeFromNaughty(t.root)
+
+	workers := budget.Workers
+	if workers <= 0 {
+		workers = t.NumSimulation
+	}
+	var playouts int64
+	if expanded {
+		playouts = 1
+	}
 	var eg multierror.Group
-	for i := 0; i < t.NumSimulation; i++ {
+	for i := 0; i < workers; i++ {
 		eg.Go(func() error {
-			g := t.current.Clone()
-			_, err := t.pipeline(g, t.root, 0)
-			return err
+			for ctx.Err() == nil {
+				if budget.Playouts > 0 && atomic.AddInt64(&playouts, 1) > int64(budget.Playouts) {
+					return nil
+				}
+				if budget.Nodes > 0 && int(t.nodeCount()) >= budget.Nodes {
+					return nil
+				}
+				g := t.current.Clone()
+				if _, err := t.pipeline(g, t.root, 0); err != nil {
+					cancel()
+					return err
+				}
+				atomic.AddInt64(&t.playouts, 1)
+			}
+			return nil
 		})
 	}
 	egErr := eg.Wait()
@@ -60,7 +131,6 @@ func (t *MCTS) Search() (game.Move, error) {
 		return "", egErr
 	}
 
-	root := t.nodeFromNaughty(t.root)
 	if !root.HasChildren() {
 		return "", fmt.Errorf("no child node in tree")
 	}
@@ -75,6 +145,38 @@ func (t *MCTS) Search() (game.Move, error) {
 	return m, nil
 }
 
+// prepareSearch moves the root to the current state, frees the nodes no longer reachable, expands the root and
+// resets the search statistics. It reports whether the root had to be expanded, which costs an evaluation.
+// It holds infoLock, so that SearchInfo never sees the tree half rebuilt.
+func (t *MCTS) prepareSearch() (expanded bool, err error) {
+	t.infoLock.Lock()
+	defer t.infoLock.Unlock()
+
+	t.updateRoot()
+
+	for _, f := range t.freeables {
+		t.free(f)
+	}
+
+	// the root is expanded before the simulations start so that noise can be added to its children
+	root := t.nodeFromNaughty(t.root)
+	var playouts int64
+	if !root.HasChildren() {
+		if _, err = t.expandAndSimulate(t.root, t.current); err != nil {
+			return false, err
+		}
+		expanded = true
+		playouts = 1
+	}
+	t.rootNoise()
+
+	atomic.StoreInt64(&t.playouts, playouts)
+	atomic.StoreInt32(&t.selDepth, 0)
+	atomic.StoreInt64(&t.finished, 0)
+	atomic.StoreInt64(&t.started, time.Now().UnixNano())
+	return expanded, nil
+}
+
 // pipeline is a recursive MCTS pipeline:
 // SELECT, EXPAND, SIMULATE, BACKPROPAGATE.
 // Because of the recursive nature, the pipeline is altered a bit to be this:
@@ -85,6 +187,7 @@ func (s *searchState) pipeline(current game.State, start Naughty, depth int) (fl
 		log.Printf("reach max depth stop: %d", s.maxDepth)
 		return 0, nil
 	}
+	s.reachDepth(depth - 1)
 	player := current.Turn()
 
 	// if the game has ended returns negative reward value because we want to return the opposite state
@@ -119,14 +222,23 @@ func (s *searchState) pipeline(current game.State, start Naughty, depth int) (fl
 
 	// SELECT and RECURSE
 	var next *Node
-	next = t.nodeFromNaughty(n.Select())
+	vl := t.VirtualLoss
+	if vl > 0 {
+		next = t.nodeFromNaughty(n.SelectVirtual(vl))
+	} else {
+		next = t.nodeFromNaughty(n.Select())
+	}
 	moveIdx := next.Move()
 	move, err := current.NNToMove(moveIdx)
-	if err != nil {
-		return 0, err
+	if err == nil {
+		current = current.Apply(move).(game.State)
+		value, err = s.pipeline(current, next.id, depth)
+	}
+
+	// BACKPROPAGATE
+	if vl > 0 {
+		next.RevertVirtualLoss(vl)
 	}
-	current = current.Apply(move).(game.State)
-	value, err = s.pipeline(current, next.id, depth)
 	if err != nil {
 		return 0, err
 	}
@@ -134,10 +246,37 @@ func (s *searchState) pipeline(current game.State, start Naughty, depth int) (fl
 	return -value, nil
 }
 
-// dirichletNoise add Dirichlet noise according to AlphaZero paper
+// reachDepth records that a playout has gone depth moves below the root.
+func (s *searchState) reachDepth(depth int) {
+	for {
+		old := atomic.LoadInt32(&s.selDepth)
+		if int32(depth) <= old || atomic.CompareAndSwapInt32(&s.selDepth, old, int32(depth)) {
+			return
+		}
+	}
+}
+
+// rootNoise adds freshly sampled Dirichlet noise to the priors of the root children according to AlphaZero paper.
+// The noise is mixed into the network priors, so noise from previous searches of the same root is replaced.
 // reference: https://stats.stackexchange.com/questions/322831/purpose-of-dirichlet-noise-in-the-alphazero-paper
-func (t *MCTS) dirichletNoise(index int32, p float32) float32 {
-	return (1-epsilon)*p + epsilon*float32(t.dirichletSample[index])
+func (t *MCTS) rootNoise() {
+	if t.DisableNoise {
+		return
+	}
+	children := t.Children(t.root)
+	if len(children) < 2 {
+		return
+	}
+
+	alpha := make([]float64, len(children))
+	for i := range alpha {
+		alpha[i] = float64(t.DirichletParam)
+	}
+	dirichletDist := distmv.NewDirichlet(alpha, distrand.NewSource(uint64(t.rand.Int63())))
+	sample := dirichletDist.Rand(nil)
+	for i, kid := range children {
+		t.nodeFromNaughty(kid).SetNoise(t.Epsilon, float32(sample[i]))
+	}
 }
 
 func (s *searchState) expandAndSimulate(parent Naughty, state game.State) (float32, error) {
@@ -154,27 +293,21 @@ func (s *searchState) expandAndSimulate(parent Naughty, state game.State) (float
 	var nodelist []pair
 	var legalSum float32
 
-	for i := 0; i < s.current.ActionSpace(); i++ {
-		m, err := state.NNToMove(int32(i))
-		if err != nil {
-			return 0, err
-		}
-		if state.Check(m) {
-			nodelist = append(nodelist, pair{Score: policy[i], Move: int32(i)})
-			legalSum += policy[i]
-		}
+	// not every index of the action space has to be a move (e.g. off board slots in the 8x8x73 encoding)
+	// so only the legal moves are looked at.
+	for _, i := range state.PossibleMoves() {
+		nodelist = append(nodelist, pair{Score: policy[i], Move: i})
+		legalSum += policy[i]
 	}
 
 	if legalSum > math32.SmallestNonzeroFloat32 {
 		for i := range nodelist {
 			nodelist[i].Score /= legalSum
-			nodelist[i].Score = t.dirichletNoise(nodelist[i].Move, nodelist[i].Score)
 		}
 	} else {
 		prob := 1 / float32(len(nodelist))
 		for i := range nodelist {
 			nodelist[i].Score = prob
-			nodelist[i].Score = t.dirichletNoise(nodelist[i].Move, nodelist[i].Score)
 		}
 	}
 
@@ -304,12 +437,24 @@ func (t *MCTS) updatePolicies() {
 			denominator += math32.Pow(float32(visits), 1/t.Config.RandomTemperature)
 		}
 	}
+	// without any playout below the root, e.g. when the budget only covered its expansion, the priors are used
+	usePriors := denominator == 0
+	if usePriors {
+		for _, kid := range children {
+			if child := tree.nodeFromNaughty(kid); child.IsValid() {
+				denominator += child.PSA()
+			}
+		}
+	}
 
 	policies := make([]float32, t.current.ActionSpace())
 	for _, kid := range children {
 		child := tree.nodeFromNaughty(kid)
 		if child.IsValid() {
 			numerator := math32.Pow(float32(child.Visits()), 1/temp)
+			if usePriors {
+				numerator = child.PSA()
+			}
 			p := numerator / denominator
 			policies[child.Move()] = p
 			child.SetPi(p)
@@ -0,0 +1,220 @@
+package mcts
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alphabeth/game"
+	"github.com/awalterschulze/gographviz"
+)
+
+// gatedInferencer holds every Infer call until want calls are waiting (or a timeout passes),
+// so that all simulations of a search are in flight at the same time.
+type gatedInferencer struct {
+	sync.Mutex
+	want    int
+	calls   int
+	release chan struct{}
+	seen    map[string]int
+}
+
+func newGatedInferencer(want int) *gatedInferencer {
+	return &gatedInferencer{
+		want:    want,
+		release: make(chan struct{}),
+		seen:    make(map[string]int),
+	}
+}
+
+func (inf *gatedInferencer) Infer(state game.State) (policy []float32, value float32) {
+	inf.Lock()
+	inf.calls++
+	inf.seen[state.FEN()]++
+	if inf.calls == inf.want {
+		close(inf.release)
+	}
+	inf.Unlock()
+
+	select {
+	case <-inf.release:
+	case <-time.After(time.Second):
+	}
+
+	policy = make([]float32, state.ActionSpace())
+	for i := range policy {
+		policy[i] = 1
+	}
+	return policy, 0
+}
+
+func (inf *gatedInferencer) reset(want int) {
+	inf.Lock()
+	inf.want = want
+	inf.calls = 0
+	inf.release = make(chan struct{})
+	inf.seen = make(map[string]int)
+	inf.Unlock()
+}
+
+func leafSpread(t *testing.T, virtualLoss float32) int {
+	const simulations = 8
+	conf := Config{
+		PUCT:              1.0,
+		RandomTemperature: 1,
+		MaxDepth:          100,
+		NumSimulation:     1,
+		VirtualLoss:       virtualLoss,
+		DisableNoise:      true,
+	}
+	inf := newGatedInferencer(1)
+	tree := New(game.ChessGameAZ(), conf, inf)
+
+	// expand the root first
+	if _, err := tree.Search(); err != nil {
+		t.Fatal(err)
+	}
+
+	inf.reset(simulations)
+	tree.NumSimulation = simulations
+	if _, err := tree.Search(); err != nil {
+		t.Fatal(err)
+	}
+	return len(inf.seen)
+}
+
+func TestVirtualLossSpreadsSimulations(t *testing.T) {
+	if spread := leafSpread(t, 0); spread != 1 {
+		t.Errorf("Expected all simulations without virtual loss to evaluate the same leaf. Got %d leaves", spread)
+	}
+	if spread := leafSpread(t, 1); spread != 8 {
+		t.Errorf("Expected parallel simulations with virtual loss to evaluate 8 distinct leaves. Got %d leaves", spread)
+	}
+}
+
+func TestVirtualLossReverted(t *testing.T) {
+	conf := Config{
+		PUCT:              1.0,
+		RandomTemperature: 1,
+		MaxDepth:          100,
+		NumSimulation:     1,
+		DisableNoise:      true,
+	}
+	tree := New(game.ChessGameAZ(), conf, newGatedInferencer(1))
+	n := tree.nodeFromNaughty(tree.New(0, 0.5))
+	n.Update(0.5)
+	n.Update(-0.25)
+	visits, qsa := n.Visits(), n.QSA()
+
+	n.addVirtualLoss(1)
+	if n.Visits() != visits+1 || n.QSA() >= qsa {
+		t.Errorf("Expected virtual loss to add a visit and lower Q. Got visits %d Q %v", n.Visits(), n.QSA())
+	}
+	n.RevertVirtualLoss(1)
+	if n.Visits() != visits || n.QSA()-qsa > 1e-6 || qsa-n.QSA() > 1e-6 {
+		t.Errorf("Expected visits %d and Q %v after reverting virtual loss. Got visits %d Q %v", visits, qsa, n.Visits(), n.QSA())
+	}
+}
+
+func TestSearchInfo(t *testing.T) {
+	conf := Config{
+		PUCT:              1.0,
+		RandomTemperature: 1,
+		MaxDepth:          100,
+		NumSimulation:     16,
+		DisableNoise:      true,
+	}
+	tree := New(game.ChessGameAZ(), conf, newGatedInferencer(1))
+	if _, err := tree.Search(); err != nil {
+		t.Fatal(err)
+	}
+
+	info := tree.SearchInfo()
+	if info.Playouts != conf.NumSimulation {
+		t.Errorf("Expected %d playouts. Got %d", conf.NumSimulation, info.Playouts)
+	}
+	if len(info.Children) != 20 {
+		t.Fatalf("Expected 20 root children in the starting position. Got %d", len(info.Children))
+	}
+	for i := 1; i < len(info.Children); i++ {
+		if info.Children[i].Visits > info.Children[i-1].Visits {
+			t.Errorf("Expected children to be sorted by visits. Got %v", info.Children)
+			break
+		}
+	}
+	if len(info.PV) == 0 || info.PV[0] != info.Children[0].Move {
+		t.Errorf("Expected the principal variation to start with the most visited child %d. Got %v", info.Children[0].Move, info.PV)
+	}
+	if info.SelDepth < 1 || info.Elapsed <= 0 || info.NodesPerSecond <= 0 {
+		t.Errorf("Expected positive depth, elapsed time and speed. Got %d, %v, %v", info.SelDepth, info.Elapsed, info.NodesPerSecond)
+	}
+}
+
+func TestSearchBudgetCountsRootExpansion(t *testing.T) {
+	conf := Config{
+		PUCT:              1.0,
+		RandomTemperature: 1,
+		MaxDepth:          100,
+		NumSimulation:     1,
+		DisableNoise:      true,
+	}
+	inf := newGatedInferencer(1)
+	tree := New(game.ChessGameAZ(), conf, inf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := tree.SearchWithBudget(ctx, Budget{Playouts: 10}); err != context.Canceled {
+		t.Errorf("Expected %v from a cancelled search. Got %v", context.Canceled, err)
+	}
+	if inf.calls != 0 {
+		t.Errorf("Expected a cancelled search not to evaluate. Got %d evaluations", inf.calls)
+	}
+
+	// the expansion of the root uses up a budget of one playout
+	if _, err := tree.SearchWithBudget(context.Background(), Budget{Playouts: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if inf.calls != 1 {
+		t.Errorf("Expected 1 evaluation. Got %d", inf.calls)
+	}
+	if info := tree.SearchInfo(); info.Playouts != 1 {
+		t.Errorf("Expected 1 playout. Got %d", info.Playouts)
+	}
+	var sum float32
+	for _, p := range tree.policies {
+		if p != p {
+			t.Fatalf("Expected a policy without NaN. Got %v", tree.policies)
+		}
+		sum += p
+	}
+	if sum < 0.999 || sum > 1.001 {
+		t.Errorf("Expected the policy to sum to 1. Got %v", sum)
+	}
+}
+
+func TestToDot(t *testing.T) {
+	conf := Config{
+		PUCT:              1.0,
+		RandomTemperature: 1,
+		MaxDepth:          100,
+		NumSimulation:     16,
+		DisableNoise:      true,
+	}
+	tree := New(game.ChessGameAZ(), conf, newGatedInferencer(1))
+	if _, err := tree.Search(); err != nil {
+		t.Fatal(err)
+	}
+
+	dot, err := tree.ToDot(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gographviz.Read([]byte(dot)); err != nil {
+		t.Fatalf("Expected a valid DOT graph. Got %v\n%s", err, dot)
+	}
+	if edges := strings.Count(dot, "->"); edges == 0 || edges > 3+3*3 {
+		t.Errorf("Expected between 1 and 12 edges for top 3 children down to depth 2. Got %d\n%s", edges, dot)
+	}
+}
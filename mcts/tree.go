@@ -5,12 +5,11 @@ import (
 	"math/rand"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/alphabeth/game"
 	"github.com/chewxy/math32"
-	distrand "golang.org/x/exp/rand"
-	"gonum.org/v1/gonum/stat/distmv"
 )
 
 // Config is the structure to configure the MCTS multitree (poorly named Tree)
@@ -22,18 +21,35 @@ type Config struct {
 	RandomTemperature float32
 	MaxDepth          int
 	NumSimulation     int // Be careful with this config it can cause goroutine starvation.
+
+	// Dirichlet noise is mixed into the priors of the root children at every search for exploration,
+	// as P(s, a) = (1 - Epsilon) * p + Epsilon * Dir(DirichletParam). Both must be positive unless DisableNoise
+	// is set.
+	Epsilon        float32
+	DirichletParam float32
+	DisableNoise   bool // turns noise off, e.g. for evaluation and competitive play
+
+	// VirtualLoss is applied to a node while a simulation passing through it is in flight, so that concurrent
+	// simulations don't all pile onto the same leaf. 0 disables it.
+	VirtualLoss float32
 }
 
-// DefaultConfig returns default config.
+// DefaultConfig returns default config. It is valid as is, e.g. for tools that never search but need a config
+// to store with a checkpoint.
 func DefaultConfig() Config {
 	return Config{
-		PUCT: 1.0,
+		PUCT:              1.0,
+		RandomTemperature: 1,
+		NumSimulation:     10,
+		Epsilon:           0.25,
+		DirichletParam:    0.3,
 	}
 }
 
 // IsValid checks config parameters.
 func (c Config) IsValid() bool {
-	return c.RandomTemperature > 0 && c.NumSimulation > 0
+	return c.RandomTemperature > 0 && c.NumSimulation > 0 &&
+		(c.DisableNoise || c.Epsilon > 0 && c.Epsilon <= 1 && c.DirichletParam > 0)
 }
 
 // MCTS is essentially a "global" manager of sorts for the memories. The goal is to build MCTS without much pointer chasing.
@@ -56,8 +72,9 @@ type MCTS struct {
 	nc       int32 // atomic pls
 	policies []float32
 
-	// Dirichlet noise for exploration
-	dirichletSample []float64
+	// infoLock is held while a search moves the root, frees nodes or resets the tree, readers of the search
+	// statistics hold it for reading.
+	infoLock sync.RWMutex
 }
 
 // New creates new mcts tree.
@@ -76,13 +93,6 @@ func New(game game.State, conf Config, nn Inferencer) *MCTS {
 		policies: nil,
 	}
 
-	alpha := make([]float64, game.ActionSpace())
-	for i := 0; i < game.ActionSpace(); i++ {
-		alpha[i] = dirichletParam
-	}
-
-	dirichletDist := distmv.NewDirichlet(alpha, distrand.NewSource(uint64(time.Now().UnixNano())))
-	retVal.dirichletSample = dirichletDist.Rand(nil)
 	retVal.searchState.tree = ptrFromTree(retVal)
 	retVal.searchState.maxDepth = conf.MaxDepth
 	return retVal
@@ -94,11 +104,13 @@ func (t *MCTS) New(move int32, score float32) (retVal Naughty) {
 	N := t.nodeFromNaughty(n)
 	N.lock.Lock()
 	defer N.lock.Unlock()
+	atomic.AddInt32(&t.nc, 1)
 	N.move = move
 	N.visits = 1
 	N.status = uint32(Active)
 	N.qsa = 0
 	N.psa = score
+	N.prior = score
 
 	return n
 }
@@ -121,6 +133,65 @@ func (t *MCTS) Policies() ([]float32, error) {
 	return t.policies, nil
 }
 
+// RootValue returns the value of the root from the perspective of the player to move,
+// estimated as the visit weighted average of Q(s, a) over the root children.
+func (t *MCTS) RootValue() float32 {
+	var sum float32
+	var visits uint32
+	for _, kid := range t.Children(t.root) {
+		child := t.nodeFromNaughty(kid)
+		if !child.IsValid() {
+			continue
+		}
+		v := child.Visits()
+		sum += float32(v) * child.QSA()
+		visits += v
+	}
+	if visits == 0 {
+		return 0
+	}
+	return sum / float32(visits)
+}
+
+// RootVisits returns the total number of visits to the root children.
+func (t *MCTS) RootVisits() uint32 {
+	var visits uint32
+	for _, kid := range t.Children(t.root) {
+		child := t.nodeFromNaughty(kid)
+		if child.IsValid() {
+			visits += child.Visits()
+		}
+	}
+	return visits
+}
+
+// PrincipalVariation returns the best line found by the search as neural network move indices,
+// following the most visited children from the root.
+func (t *MCTS) PrincipalVariation() []int32 {
+	var pv []int32
+	n := t.root
+	for n != nilNode {
+		// nodes start with one visit, so children which were never searched are left out of the line.
+		best := nilNode
+		bestVisits := uint32(1)
+		for _, kid := range t.Children(n) {
+			child := t.nodeFromNaughty(kid)
+			if !child.IsValid() {
+				continue
+			}
+			if v := child.Visits(); v > bestVisits {
+				best, bestVisits = kid, v
+			}
+		}
+		if best == nilNode {
+			break
+		}
+		pv = append(pv, t.nodeFromNaughty(best).Move())
+		n = best
+	}
+	return pv
+}
+
 // alloc tries to get a node from the free list. If none is found a new node is allocated into the master arena
 func (t *MCTS) alloc() Naughty {
 	t.Lock()
@@ -220,6 +291,8 @@ func (t *MCTS) sampleChild() int {
 
 // Reset resets mcts tree.
 func (t *MCTS) Reset() {
+	t.infoLock.Lock()
+	defer t.infoLock.Unlock()
 	t.Lock()
 	defer t.Unlock()
 
@@ -230,6 +303,7 @@ func (t *MCTS) Reset() {
 		t.nodes[i].visits = 0
 		t.nodes[i].status = 0
 		t.nodes[i].psa = 0
+		t.nodes[i].prior = 0
 		t.nodes[i].hasChildren = false
 		t.nodes[i].qsa = 0
 		t.freelist = append(t.freelist, t.nodes[i].id)
@@ -0,0 +1,157 @@
+package agogo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alphabeth/game"
+	"github.com/alphabeth/mcts"
+	"github.com/notnil/chess"
+)
+
+// constant variables for PGN export.
+const (
+	pgnTopK     = 3 // number of policy entries written in each move comment
+	pgnLineSize = 80
+)
+
+// pgnMove is a move in standard algebraic notation with its search annotation.
+type pgnMove struct {
+	san     string
+	comment string
+}
+
+// pgnRecord records a game so that it can be written out as PGN.
+type pgnRecord struct {
+	fen   string // root position of the game
+	moves []pgnMove
+}
+
+func newPGNRecord(g game.State) *pgnRecord {
+	return &pgnRecord{fen: g.FEN()}
+}
+
+// annotate records the move about to be played in g along with the search statistics of the root.
+func (r *pgnRecord) annotate(g game.State, m game.Move, info mcts.SearchInfo, policies []float32) {
+	positions := g.Positions()
+	pos := positions[len(positions)-1]
+	san := string(m)
+	for _, mv := range pos.ValidMoves() {
+		if mv.String() == string(m) {
+			san = chess.AlgebraicNotation{}.Encode(pos, mv)
+			break
+		}
+	}
+
+	idx := make([]int, len(policies))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return policies[idx[i]] > policies[idx[j]] })
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "value: %.3f, playouts: %d, seldepth: %d, policy:", info.Value, info.Playouts, info.SelDepth)
+	for i := 0; i < pgnTopK && i < len(idx); i++ {
+		if policies[idx[i]] <= 0 {
+			break
+		}
+		mv, err := g.NNToMove(int32(idx[i]))
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&buf, " %s %.3f", mv, policies[idx[i]])
+	}
+	r.moves = append(r.moves, pgnMove{san: san, comment: buf.String()})
+}
+
+// pgnTermination maps the way a game ended to the Termination tag values of the PGN standard. All endings by the
+// rules of chess, resignation and agreed draws included, are "normal". A game that ended without any of them had
+// its result decided from outside.
+func pgnTermination(m chess.Method) string {
+	if m == chess.NoMethod {
+		return "adjudication"
+	}
+	return "normal"
+}
+
+// write writes the recorded game as PGN with the given round, players and final state.
+func (r *pgnRecord) write(w io.Writer, event string, round int, white, black string, g game.State) error {
+	result := "*"
+	termination := "unterminated"
+	if ended, winner := g.Ended(); ended {
+		switch winner {
+		case chess.White:
+			result = "1-0"
+		case chess.Black:
+			result = "0-1"
+		default:
+			result = "1/2-1/2"
+		}
+		termination = pgnTermination(g.Method())
+	}
+
+	var buf bytes.Buffer
+	tag := func(k, v string) { fmt.Fprintf(&buf, "[%s %q]\n", k, v) }
+	tag("Event", event)
+	tag("Site", "?")
+	tag("Date", time.Now().Format("2006.01.02"))
+	tag("Round", strconv.Itoa(round))
+	tag("White", white)
+	tag("Black", black)
+	tag("Result", result)
+	tag("Termination", termination)
+	if r.fen != game.StartFEN {
+		tag("SetUp", "1")
+		tag("FEN", r.fen)
+	}
+	buf.WriteString("\n")
+
+	moveNum, blackFirst := 1, false
+	if fields := strings.Fields(r.fen); len(fields) == 6 {
+		blackFirst = fields[1] == "b"
+		if n, err := strconv.Atoi(fields[5]); err == nil {
+			moveNum = n
+		}
+	}
+
+	var tokens []string
+	for i, m := range r.moves {
+		black := (i%2 == 1) != blackFirst
+		switch {
+		case !black:
+			tokens = append(tokens, fmt.Sprintf("%d.", moveNum))
+		case i == 0 || r.moves[i-1].comment != "":
+			// black moves need their number repeated at the start or after a comment
+			tokens = append(tokens, fmt.Sprintf("%d...", moveNum))
+		}
+		tokens = append(tokens, m.san, "{"+m.comment+"}")
+		if black {
+			moveNum++
+		}
+	}
+	tokens = append(tokens, result)
+
+	var lineLen int
+	for i, t := range tokens {
+		if i > 0 {
+			if lineLen+1+len(t) > pgnLineSize {
+				buf.WriteString("\n")
+				lineLen = 0
+			} else {
+				buf.WriteString(" ")
+				lineLen++
+			}
+		}
+		buf.WriteString(t)
+		lineLen += len(t)
+	}
+	buf.WriteString("\n\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
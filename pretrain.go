@@ -0,0 +1,107 @@
+package agogo
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/alphabeth/game"
+	"github.com/notnil/chess"
+	"github.com/pkg/errors"
+)
+
+// ExamplesFromPGN reads games from a PGN collection and replays each of them through a clone of g.
+// Every position is encoded with enc, the policy is a one hot vector on the move that was played and the value
+// is the final game result from the perspective of the player to move.
+// Games without a result, games starting from a different position than g and games containing moves outside of
+// the action space are skipped.
+func ExamplesFromPGN(r io.Reader, g game.State, enc GameEncoder) ([]Example, error) {
+	var examples []Example
+	var games, skipped int
+
+	state := g.Clone()
+	state.Reset()
+	rootFEN := state.FEN()
+
+	scanner := chess.NewScanner(r)
+	for scanner.Scan() {
+		games++
+		pgn := scanner.Next()
+		exs, err := examplesFromGame(pgn, state, rootFEN, enc)
+		state.Reset()
+		if err != nil {
+			log.Printf("skipping game %d: %v", games, err)
+			skipped++
+			continue
+		}
+		examples = append(examples, exs...)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.WithMessage(err, fmt.Sprintf("reading game %d", games+1))
+	}
+	log.Printf("read %d examples from %d games, skipped %d games", len(examples), games, skipped)
+	return examples, nil
+}
+
+func examplesFromGame(pgn *chess.Game, state game.State, rootFEN string, enc GameEncoder) ([]Example, error) {
+	var winner chess.Color
+	switch pgn.Outcome() {
+	case chess.WhiteWon:
+		winner = chess.White
+	case chess.BlackWon:
+		winner = chess.Black
+	case chess.Draw:
+		winner = chess.NoColor
+	default:
+		return nil, errors.New("game has no result")
+	}
+
+	positions := pgn.Positions()
+	if positions[0].String() != rootFEN {
+		return nil, errors.Errorf("game starts from %q instead of %q", positions[0], rootFEN)
+	}
+
+	examples := make([]Example, 0, len(pgn.Moves()))
+	for _, m := range pgn.Moves() {
+		move := game.Move(m.String())
+		idx, err := state.MoveToNN(move)
+		if err != nil {
+			return nil, err
+		}
+		if !state.Check(move) {
+			return nil, errors.Errorf("illegal move %s", move)
+		}
+
+		policy := make([]float32, state.ActionSpace())
+		policy[idx] = 1
+		var value float32
+		switch {
+		case winner == chess.NoColor:
+			value = 0
+		case winner == state.Turn():
+			value = 1
+		default:
+			value = -1
+		}
+		examples = append(examples, Example{
+			Board:  enc(state),
+			Policy: policy,
+			Value:  value,
+		})
+		state = state.Apply(move)
+	}
+	return examples, nil
+}
+
+// Pretrain trains the current network on examples, e.g. read from a PGN collection with ExamplesFromPGN,
+// for nniters epochs.
+func (a *AZ) Pretrain(examples []Example, nniters int) error {
+	if a.maxExamples > 0 && len(examples) > a.maxExamples {
+		shuffleExamples(examples)
+		examples = examples[:a.maxExamples]
+	}
+	if err := a.train(a.CurrentAgent.NN, examples, nniters); err != nil {
+		return errors.WithMessage(err, "Pretrain fail")
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package agogo
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alphabeth/game"
+	"github.com/stretchr/testify/assert"
+)
+
+// testPGN holds a white win, an unfinished game, a black win, a game from another position and a draw.
+const testPGN = `[Event "scholar's mate"]
+[Result "1-0"]
+
+1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6 4. Qxf7# 1-0
+
+[Event "unfinished"]
+[Result "*"]
+
+1. d4 d5 *
+
+[Event "fool's mate"]
+[Result "0-1"]
+
+1. f3 e5 2. g4 Qh4# 0-1
+
+[Event "kings only"]
+[Result "1/2-1/2"]
+[SetUp "1"]
+[FEN "4k3/8/8/8/8/8/8/4K3 w - - 0 1"]
+
+1. Kd2 Kd7 1/2-1/2
+
+[Event "draw"]
+[Result "1/2-1/2"]
+
+1. Nf3 Nf6 1/2-1/2
+
+`
+
+func TestExamplesFromPGN(t *testing.T) {
+	assert := assert.New(t)
+	g := game.ChessGameAZ()
+	enc := game.SimpleEncoder{}.Encode
+	examples, err := ExamplesFromPGN(strings.NewReader(testPGN), g, enc)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	games := []struct {
+		moves []game.Move
+		white float32 // value for white
+	}{
+		{[]game.Move{"e2e4", "e7e5", "f1c4", "b8c6", "d1h5", "g8f6", "h5f7"}, 1},
+		{[]game.Move{"f2f3", "e7e5", "g2g4", "d8h4"}, -1},
+		{[]game.Move{"g1f3", "g8f6"}, 0},
+	}
+	var expected int
+	for _, gm := range games {
+		expected += len(gm.moves)
+	}
+	if !assert.Len(examples, expected) {
+		return
+	}
+
+	var i int
+	for _, gm := range games {
+		state := g.Clone()
+		state.Reset()
+		for ply, m := range gm.moves {
+			ex := examples[i]
+			i++
+			assert.Equal(enc(state), ex.Board, "board of %s", m)
+
+			idx, err := state.MoveToNN(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var sum float32
+			for _, p := range ex.Policy {
+				sum += p
+			}
+			assert.Len(ex.Policy, g.ActionSpace())
+			assert.Equal(float32(1), ex.Policy[idx], "policy of %s", m)
+			assert.Equal(float32(1), sum, "policy of %s is not one hot", m)
+
+			value := gm.white
+			if ply%2 == 1 {
+				value = -value
+			}
+			assert.Equal(value, ex.Value, "value of %s", m)
+			state = state.Apply(m)
+		}
+	}
+	assert.Equal(game.ChessGameAZ().FEN(), g.FEN(), "g was modified")
+}
+
+func TestExamplesFromPGNOutsideActionSpace(t *testing.T) {
+	g := game.ChessGameFromMoves([]game.Move{"e2e4", "e7e5", "f1c4", "b8c6", "d1h5", "g8f6", "h5f7", "g1f3"})
+	examples, err := ExamplesFromPGN(strings.NewReader(testPGN), g, game.SimpleEncoder{}.Encode)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	// only scholar's mate stays within the action space
+	assert.Len(t, examples, 7)
+}
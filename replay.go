@@ -0,0 +1,208 @@
+package agogo
+
+import (
+	"encoding/gob"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alphabeth/internal/atomicfile"
+	"github.com/pkg/errors"
+)
+
+// Sampling is the way examples are drawn from a ReplayBuffer.
+type Sampling int
+
+// sampling strategies.
+const (
+	UniformSampling Sampling = iota // every example is equally likely
+	RecencySampling                 // examples of older generations are drawn less often
+)
+
+// ReplayConfig configures the sliding window of a ReplayBuffer. Zero limits mean no limit for the buffer itself,
+// but New treats a config without any limit as MaxGenerations 1, so AZ trains on the games of the current iteration
+// only unless a window is configured.
+type ReplayConfig struct {
+	MaxGames       int      `json:"max_games"`       // number of most recent games kept
+	MaxGenerations int      `json:"max_generations"` // number of most recent generations kept
+	Sampling       Sampling `json:"sampling"`
+	// Decay is the weight factor per generation of age for recency-weighted sampling, in (0, 1].
+	Decay float64 `json:"decay"`
+}
+
+// IsValid returns true when the config is usable.
+func (c ReplayConfig) IsValid() bool {
+	if c.MaxGames < 0 || c.MaxGenerations < 0 {
+		return false
+	}
+	switch c.Sampling {
+	case UniformSampling:
+		return true
+	case RecencySampling:
+		return c.Decay > 0 && c.Decay <= 1
+	}
+	return false
+}
+
+// replayGame holds the examples of one self-play game.
+type replayGame struct {
+	Generation int
+	Examples   []Example
+}
+
+// replayFile is the on disk format of a ReplayBuffer.
+type replayFile struct {
+	Generation int
+	Games      []replayGame
+}
+
+// ReplayBuffer keeps the self-play examples of the most recent games or generations so that the network is trained
+// on a sliding window of data instead of only the games of the last iteration.
+// A generation is one training iteration, all games played by the same network belong to the same generation.
+type ReplayBuffer struct {
+	sync.Mutex
+	ReplayConfig
+
+	generation int
+	games      []replayGame
+	rand       *rand.Rand
+}
+
+// NewReplayBuffer creates an empty replay buffer.
+func NewReplayBuffer(conf ReplayConfig) *ReplayBuffer {
+	return &ReplayBuffer{
+		ReplayConfig: conf,
+		rand:         rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// LoadReplayBuffer reads a replay buffer saved with Save. The window of conf is applied to the loaded games.
+func LoadReplayBuffer(filename string, conf ReplayConfig) (*ReplayBuffer, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.Close()
+
+	var rf replayFile
+	if err := gob.NewDecoder(f).Decode(&rf); err != nil {
+		return nil, errors.WithMessage(err, "decoding replay buffer")
+	}
+	b := NewReplayBuffer(conf)
+	b.generation = rf.Generation
+	b.games = rf.Games
+	b.evict()
+	return b, nil
+}
+
+// Save writes the replay buffer to filename atomically.
+func (b *ReplayBuffer) Save(filename string) error {
+	b.Lock()
+	defer b.Unlock()
+
+	return atomicfile.Write(filename, 0644, func(w io.Writer) error {
+		if err := gob.NewEncoder(w).Encode(replayFile{Generation: b.generation, Games: b.games}); err != nil {
+			return errors.WithMessage(err, "encoding replay buffer")
+		}
+		return nil
+	})
+}
+
+// Add adds the examples of one game to the current generation, dropping the oldest games outside of the window.
+func (b *ReplayBuffer) Add(examples []Example) {
+	b.Lock()
+	defer b.Unlock()
+	b.games = append(b.games, replayGame{Generation: b.generation, Examples: examples})
+	b.evict()
+}
+
+// NextGeneration starts a new generation, dropping the generations outside of the window.
+func (b *ReplayBuffer) NextGeneration() {
+	b.Lock()
+	defer b.Unlock()
+	b.generation++
+	b.evict()
+}
+
+// Generation returns the current generation.
+func (b *ReplayBuffer) Generation() int {
+	b.Lock()
+	defer b.Unlock()
+	return b.generation
+}
+
+// Games returns the number of games in the buffer.
+func (b *ReplayBuffer) Games() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.games)
+}
+
+// Len returns the number of examples in the buffer.
+func (b *ReplayBuffer) Len() int {
+	b.Lock()
+	defer b.Unlock()
+	var n int
+	for _, g := range b.games {
+		n += len(g.Examples)
+	}
+	return n
+}
+
+func (b *ReplayBuffer) evict() {
+	drop := 0
+	if b.MaxGames > 0 && len(b.games) > b.MaxGames {
+		drop = len(b.games) - b.MaxGames
+	}
+	for drop < len(b.games) && b.MaxGenerations > 0 && b.games[drop].Generation <= b.generation-b.MaxGenerations {
+		drop++
+	}
+	if drop > 0 {
+		b.games = append(b.games[:0], b.games[drop:]...)
+	}
+}
+
+// Sample draws n examples from the buffer. Uniform sampling draws without replacement and returns all examples,
+// shuffled, when n is not smaller than the buffer. Recency-weighted sampling draws with replacement, every example
+// being weighted with Decay to the power of the age of its generation.
+func (b *ReplayBuffer) Sample(n int) []Example {
+	b.Lock()
+	defer b.Unlock()
+
+	var all []Example
+	var cumulative []float64 // cumulative weights of all
+	var total float64
+	for _, g := range b.games {
+		w := 1.0
+		if b.Sampling == RecencySampling {
+			w = math.Pow(b.Decay, float64(b.generation-g.Generation))
+		}
+		for _, ex := range g.Examples {
+			all = append(all, ex)
+			total += w
+			cumulative = append(cumulative, total)
+		}
+	}
+	if len(all) == 0 || n <= 0 {
+		return nil
+	}
+
+	if b.Sampling == UniformSampling {
+		b.rand.Shuffle(len(all), func(i, j int) { all[i], all[j] = all[j], all[i] })
+		if n < len(all) {
+			all = all[:n]
+		}
+		return all
+	}
+
+	retVal := make([]Example, n)
+	for i := range retVal {
+		x := b.rand.Float64() * total
+		retVal[i] = all[sort.SearchFloat64s(cumulative, x)]
+	}
+	return retVal
+}
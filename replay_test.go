@@ -0,0 +1,132 @@
+package agogo
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alphabeth/game"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayBufferGenerationEviction(t *testing.T) {
+	assert := assert.New(t)
+	b := NewReplayBuffer(ReplayConfig{MaxGenerations: 2})
+	for gen := 0; gen < 4; gen++ {
+		b.Add(testGame(1, float32(gen)))
+		b.Add(testGame(2, float32(gen)))
+		b.NextGeneration()
+	}
+	// generation 4 has started, so only the games of generation 3 are left
+	assert.Equal(4, b.Generation())
+	assert.Equal(2, b.Games())
+	assert.Equal(3, b.Len())
+	for _, ex := range b.Sample(10) {
+		assert.Equal(float32(3), ex.Value)
+	}
+
+	b.Add(testGame(4, 4))
+	assert.Equal(3, b.Games())
+	assert.Equal(7, b.Len())
+}
+
+func TestReplayBufferGameEviction(t *testing.T) {
+	assert := assert.New(t)
+	b := NewReplayBuffer(ReplayConfig{MaxGames: 3})
+	for i := 0; i < 5; i++ {
+		b.Add(testGame(1, float32(i)))
+		b.NextGeneration()
+	}
+	assert.Equal(3, b.Games())
+	seen := make(map[float32]bool)
+	for _, ex := range b.Sample(10) {
+		seen[ex.Value] = true
+	}
+	assert.Equal(map[float32]bool{2: true, 3: true, 4: true}, seen)
+}
+
+func TestReplayBufferUniformSampling(t *testing.T) {
+	assert := assert.New(t)
+	b := NewReplayBuffer(ReplayConfig{})
+	b.Add(testGame(5, 0))
+	assert.Len(b.Sample(3), 3)
+	// without replacement all examples are returned at most once
+	assert.Len(b.Sample(10), 5)
+	assert.Nil(NewReplayBuffer(ReplayConfig{}).Sample(3))
+}
+
+func TestReplayBufferRecencySampling(t *testing.T) {
+	assert := assert.New(t)
+	b := NewReplayBuffer(ReplayConfig{Sampling: RecencySampling, Decay: 0.5})
+	b.rand = rand.New(rand.NewSource(1))
+	b.Add(testGame(100, 0))
+	b.NextGeneration()
+	b.Add(testGame(100, 1))
+
+	// the examples of generation 0 weigh half as much as those of generation 1
+	const n = 30000
+	var old int
+	samples := b.Sample(n)
+	assert.Len(samples, n)
+	for _, ex := range samples {
+		if ex.Value == 0 {
+			old++
+		}
+	}
+	assert.InDelta(1.0/3, float64(old)/n, 0.02)
+}
+
+func TestReplayBufferSaveLoad(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	b := NewReplayBuffer(ReplayConfig{MaxGenerations: 3})
+	for gen := 0; gen < 3; gen++ {
+		if gen > 0 {
+			b.NextGeneration()
+		}
+		b.Add(testGame(gen+1, float32(gen)))
+	}
+	filename := filepath.Join(dir, "replay.gob")
+	if err := b.Save(filename); err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	loaded, err := LoadReplayBuffer(filename, ReplayConfig{MaxGenerations: 3})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assert.Equal(b.Generation(), loaded.Generation())
+	assert.Equal(b.games, loaded.games)
+
+	// the window of the new config applies to the loaded games
+	loaded, err = LoadReplayBuffer(filename, ReplayConfig{MaxGenerations: 1})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	assert.Equal(1, loaded.Games())
+	assert.Equal(3, loaded.Len())
+
+	_, err = LoadReplayBuffer(filepath.Join(dir, "missing.gob"), ReplayConfig{})
+	assert.Error(err)
+}
+
+func TestNewReplayWindow(t *testing.T) {
+	assert := assert.New(t)
+	conf := testConfig(game.ChessGameAZ())
+	conf.Replay = ReplayConfig{}
+	a := New(game.ChessGameAZ(), conf)
+	assert.Equal(1, a.Replay.MaxGenerations)
+	assert.Equal(0, a.Replay.MaxGames)
+
+	conf.Replay = ReplayConfig{MaxGames: 10}
+	a = New(game.ChessGameAZ(), conf)
+	assert.Equal(0, a.Replay.MaxGenerations)
+	assert.Equal(10, a.Replay.MaxGames)
+}
@@ -0,0 +1,135 @@
+package agogo
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alphabeth/game"
+	"github.com/alphabeth/mcts"
+)
+
+// SelfPlayResult holds the examples of one game played by a SelfPlayPool, or the error that stopped it.
+type SelfPlayResult struct {
+	Examples []Example
+	Err      error
+}
+
+// SelfPlayPool plays self-play games on several goroutines at once. Every worker owns an Agent with its own clone
+// of the game state and its own MCTS tree, all agents share the network weights of the arena's current agent.
+type SelfPlayPool struct {
+	arena   *Arena
+	workers int
+
+	pgnLock sync.Mutex // serialises game numbering and PGN writes of the workers
+}
+
+// NewSelfPlayPool creates a pool running up to workers games of arena concurrently.
+func NewSelfPlayPool(arena *Arena, workers int) *SelfPlayPool {
+	if workers < 1 {
+		workers = 1
+	}
+	return &SelfPlayPool{
+		arena:   arena,
+		workers: workers,
+	}
+}
+
+// Play plays episodes games and sends the result of every finished game on the returned channel, which is closed
+// once all workers are done. No new game is started after a game failed.
+// The network of the arena's current agent must not be modified until the channel is closed.
+func (p *SelfPlayPool) Play(episodes int) <-chan SelfPlayResult {
+	results := make(chan SelfPlayResult, p.workers)
+	jobs := make(chan int)
+	var failed int32
+
+	var wg sync.WaitGroup
+	for w := 0; w < p.workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			p.work(w, jobs, results, &failed)
+		}(w)
+	}
+
+	go func() {
+		for e := 0; e < episodes && atomic.LoadInt32(&failed) == 0; e++ {
+			jobs <- e
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// work plays the games handed out on jobs until jobs is closed.
+func (p *SelfPlayPool) work(id int, jobs <-chan int, results chan<- SelfPlayResult, failed *int32) {
+	a := p.arena
+	agent := &Agent{
+		NN:           a.CurrentAgent.NN,
+		Enc:          a.CurrentAgent.Enc,
+		name:         fmt.Sprintf("self-play worker %d", id),
+		BatchSize:    a.CurrentAgent.BatchSize,
+		BatchTimeout: a.CurrentAgent.BatchTimeout,
+		Cache:        a.CurrentAgent.Cache, // the workers share the network, so they share its evaluations
+	}
+	g := a.game.Clone()
+	agent.MCTS = mcts.New(g, a.conf, agent)
+	if err := agent.SwitchToInference(); err != nil {
+		atomic.StoreInt32(failed, 1)
+		results <- SelfPlayResult{Err: err}
+		// keep draining so that Play is not blocked handing out games
+		for range jobs {
+		}
+		return
+	}
+
+	for range jobs {
+		if atomic.LoadInt32(failed) != 0 {
+			continue
+		}
+		var examples []Example
+		var err error
+		if g, examples, err = p.playOne(agent, g); err != nil {
+			atomic.StoreInt32(failed, 1)
+		}
+		results <- SelfPlayResult{Examples: examples, Err: err}
+		g.Reset()
+		agent.MCTS.Reset()
+		agent.MCTS = mcts.New(g, a.conf, agent)
+	}
+
+	if err := agent.Close(); err != nil {
+		atomic.StoreInt32(failed, 1)
+		results <- SelfPlayResult{Err: err}
+	}
+}
+
+// playOne plays one self-play game on g and returns the final state and the labelled examples.
+func (p *SelfPlayPool) playOne(agent *Agent, g game.State) (game.State, []Example, error) {
+	a := p.arena
+	var record *pgnRecord
+	if a.PGN != nil {
+		record = newPGNRecord(g)
+	}
+
+	g, examples, winner, err := selfPlayGame(agent, g, record)
+	if err != nil {
+		return g, nil, err
+	}
+
+	p.pgnLock.Lock()
+	a.games++
+	if record != nil {
+		event := fmt.Sprintf("%s self-play", a.name)
+		err = record.write(a.PGN, event, a.games, a.CurrentAgent.name, a.CurrentAgent.name, g)
+	}
+	p.pgnLock.Unlock()
+	if err != nil {
+		return g, nil, err
+	}
+
+	labelExamples(examples, winner)
+	return g, examples, nil
+}